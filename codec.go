@@ -0,0 +1,282 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// META_CODEC - ключ метаданных, в котором Put записывает имя кодека
+const META_CODEC = "codec"
+
+// Codec - формат сериализации значений для Put и Get
+type Codec interface {
+	// Name - имя кодека, записывается в метаданные файла
+	Name() string
+	// ContentType - MIME-тип данных
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var codecs = struct {
+	sync.RWMutex
+	byName map[string]Codec
+	byExt  map[string]Codec
+}{
+	byName: make(map[string]Codec),
+	byExt:  make(map[string]Codec),
+}
+
+func init() {
+	RegisterCodec(jsonCodec{}, ".json")
+	RegisterCodec(yamlCodec{}, ".yaml", ".yml")
+	RegisterCodec(gobCodec{}, ".gob")
+	RegisterCodec(msgpackCodec{}, ".msgpack", ".mpk")
+	RegisterCodec(cborCodec{}, ".cbor")
+	RegisterCodec(protobufCodec{}, ".pb", ".protobuf")
+}
+
+// RegisterCodec - регистрирует кодек и расширения файлов, для которых он выбирается по умолчанию.
+// Кодек с тем же именем и прежние привязки расширений заменяются
+// codec - кодек
+// exts - расширения файлов вместе с точкой, например ".yaml"
+func RegisterCodec(codec Codec, exts ...string) {
+	codecs.Lock()
+	defer codecs.Unlock()
+
+	codecs.byName[codec.Name()] = codec
+	for _, ext := range exts {
+		codecs.byExt[strings.ToLower(ext)] = codec
+	}
+}
+
+// CodecByName - возвращает зарегистрированный кодек по имени
+func CodecByName(name string) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	codec, ok := codecs.byName[name]
+	return codec, ok
+}
+
+// CodecByExt - возвращает кодек, зарегистрированный для расширения файла path
+func CodecByExt(p string) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	codec, ok := codecs.byExt[strings.ToLower(path.Ext(p))]
+	return codec, ok
+}
+
+// Codecs - возвращает имена зарегистрированных кодеков
+func Codecs() []string {
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	names := make([]string, 0, len(codecs.byName))
+	for name := range codecs.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CodecOption - параметр Put и Get
+type CodecOption func(*codecOptions)
+
+type codecOptions struct {
+	codec Codec
+}
+
+// WithCodec - использовать кодек codec вместо выбора по метаданным и расширению файла
+func WithCodec(codec Codec) CodecOption {
+	return func(o *codecOptions) {
+		o.codec = codec
+	}
+}
+
+// PutCtx - сериализует значение и записывает его в файл.
+// Кодек задается WithCodec или выбирается по расширению файла, его имя записывается в метаданные (META_CODEC)
+// ctx - контекст
+// s - хранилище
+// path - путь к файлу
+// value - значение
+// meta - метаданные файла
+// opts - параметры
+func PutCtx[T any](ctx context.Context, s StoreCtxIFace, path string, value T, meta map[string]string, opts ...CodecOption) error {
+	o := newCodecOptions(opts)
+	codec := o.codec
+	if codec == nil {
+		var ok bool
+		if codec, ok = CodecByExt(path); !ok {
+			return fmt.Errorf("%w: no codec for %q", ErrUnknownCodec, path)
+		}
+	}
+
+	content, err := codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	withCodec := make(map[string]string, len(meta)+1)
+	for key, value := range meta {
+		withCodec[key] = value
+	}
+	withCodec[META_CODEC] = codec.Name()
+	return s.CreateFileCtx(ctx, path, content, withCodec)
+}
+
+// Put - см. PutCtx
+func Put[T any](s StoreIFace, path string, value T, meta map[string]string, opts ...CodecOption) error {
+	return PutCtx(context.Background(), s, path, value, meta, opts...)
+}
+
+// GetCtx - читает файл и десериализует его в значение типа T.
+// Кодек задается WithCodec, иначе берется из метаданных файла (META_CODEC) или выбирается по расширению файла
+// ctx - контекст
+// s - хранилище
+// path - путь к файлу
+// opts - параметры
+// Если файл не существует, возвращается ErrNotExist
+func GetCtx[T any](ctx context.Context, s StoreCtxIFace, path string, opts ...CodecOption) (T, error) {
+	var value T
+	o := newCodecOptions(opts)
+	codec := o.codec
+	if codec == nil {
+		meta, err := s.GetMetaCtx(ctx, path)
+		if err != nil {
+			return value, err
+		}
+		if codec, err = codecFor(path, meta); err != nil {
+			return value, err
+		}
+	}
+
+	content, err := s.GetFileCtx(ctx, path)
+	if err != nil {
+		return value, err
+	}
+	if err := codec.Unmarshal(content, &value); err != nil {
+		return value, err
+	}
+	return value, nil
+}
+
+// Get - см. GetCtx
+func Get[T any](s StoreIFace, path string, opts ...CodecOption) (T, error) {
+	return GetCtx[T](context.Background(), s, path, opts...)
+}
+
+func newCodecOptions(opts []CodecOption) codecOptions {
+	var o codecOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// codecFor - выбирает кодек для чтения файла: по имени из метаданных, иначе по расширению
+func codecFor(path string, meta map[string]string) (Codec, error) {
+	if name, ok := meta[META_CODEC]; ok {
+		if codec, ok := CodecByName(name); ok {
+			return codec, nil
+		}
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, name)
+	}
+	if codec, ok := CodecByExt(path); ok {
+		return codec, nil
+	}
+	return nil, fmt.Errorf("%w: no codec for %q", ErrUnknownCodec, path)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                               { return "json" }
+func (jsonCodec) ContentType() string                        { return "application/json" }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type yamlCodec struct{}
+
+func (yamlCodec) Name() string                               { return "yaml" }
+func (yamlCodec) ContentType() string                        { return "application/yaml" }
+func (yamlCodec) Marshal(v interface{}) ([]byte, error)      { return yaml.Marshal(v) }
+func (yamlCodec) Unmarshal(data []byte, v interface{}) error { return yaml.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string        { return "gob" }
+func (gobCodec) ContentType() string { return "application/x-gob" }
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string                               { return "msgpack" }
+func (msgpackCodec) ContentType() string                        { return "application/msgpack" }
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error)      { return msgpack.Marshal(v) }
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error { return msgpack.Unmarshal(data, v) }
+
+type cborCodec struct{}
+
+func (cborCodec) Name() string                               { return "cbor" }
+func (cborCodec) ContentType() string                        { return "application/cbor" }
+func (cborCodec) Marshal(v interface{}) ([]byte, error)      { return cbor.Marshal(v) }
+func (cborCodec) Unmarshal(data []byte, v interface{}) error { return cbor.Unmarshal(data, v) }
+
+// protobufCodec - кодек для proto.Message.
+// Значение для Unmarshal может быть указателем на сообщение или указателем на указатель на сообщение,
+// поэтому Get работает как с Get[*pb.Msg], так и с Get[pb.Msg]
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string        { return "protobuf" }
+func (protobufCodec) ContentType() string { return "application/x-protobuf" }
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		// **Msg: сообщение создается, если указатель пустой
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Pointer {
+			return fmt.Errorf("protobuf: %T is not a proto.Message", v)
+		}
+		if rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+		}
+		if m, ok = rv.Elem().Interface().(proto.Message); !ok {
+			return fmt.Errorf("protobuf: %T is not a proto.Message", v)
+		}
+	}
+	return proto.Unmarshal(data, m)
+}
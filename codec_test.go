@@ -0,0 +1,102 @@
+package store_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/vlkalashnikov/go-store"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type codecDoc struct {
+	Name  string   `json:"name" yaml:"name" msgpack:"name" cbor:"name"`
+	Count int      `json:"count" yaml:"count" msgpack:"count" cbor:"count"`
+	Tags  []string `json:"tags" yaml:"tags" msgpack:"tags" cbor:"tags"`
+}
+
+func TestCodecs(t *testing.T) {
+	s := newMemory(t)
+	want := codecDoc{Name: "doc", Count: 3, Tags: []string{"a", "b"}}
+
+	for _, tt := range []struct{ path, codec string }{
+		{"doc.json", "json"},
+		{"doc.yaml", "yaml"},
+		{"doc.yml", "yaml"},
+		{"doc.gob", "gob"},
+		{"doc.msgpack", "msgpack"},
+		{"doc.cbor", "cbor"},
+	} {
+		if err := store.Put(s, tt.path, want, map[string]string{"author": "store"}); err != nil {
+			t.Fatalf("Put(%q): %v", tt.path, err)
+		}
+		got, err := store.Get[codecDoc](s, tt.path)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", tt.path, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Get(%q) = %+v, want %+v", tt.path, got, want)
+		}
+		meta, err := s.GetMeta(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta[store.META_CODEC] != tt.codec || meta["author"] != "store" {
+			t.Errorf("GetMeta(%q) = %v, want codec=%s and author=store", tt.path, meta, tt.codec)
+		}
+	}
+}
+
+// TestCodecFromMeta - проверяет, что при чтении кодек берется из метаданных, а не из расширения
+func TestCodecFromMeta(t *testing.T) {
+	s := newMemory(t)
+	msgpack, _ := store.CodecByName("msgpack")
+	want := codecDoc{Name: "doc"}
+
+	if err := store.Put(s, "cache.bin", want, nil, store.WithCodec(msgpack)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get[codecDoc](s, "cache.bin")
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("Get = %+v, %v; want %+v", got, err, want)
+	}
+
+	if err := store.Put(s, "cache.bin", want, nil); !errors.Is(err, store.ErrUnknownCodec) {
+		t.Fatalf("Put without codec error = %v, want ErrUnknownCodec", err)
+	}
+	if err := s.CreateFile("raw.bin", []byte("data"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get[codecDoc](s, "raw.bin"); !errors.Is(err, store.ErrUnknownCodec) {
+		t.Fatalf("Get without codec error = %v, want ErrUnknownCodec", err)
+	}
+	if _, err := store.Get[codecDoc](s, "missing.json"); !errors.Is(err, store.ErrNotExist) {
+		t.Fatalf("Get missing file error = %v, want ErrNotExist", err)
+	}
+}
+
+func TestCodecProtobuf(t *testing.T) {
+	s := newMemory(t)
+	want := wrapperspb.String("value")
+
+	if err := store.Put(s, "value.pb", want, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get[*wrapperspb.StringValue](s, "value.pb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, want) {
+		t.Fatalf("Get = %v, want %v", got, want)
+	}
+}
+
+func newMemory(t *testing.T) store.StoreIFace {
+	t.Helper()
+	s, err := store.NewMemory(store.MemoryConfig{})
+	if err != nil {
+		t.Fatalf("NewMemory: %v", err)
+	}
+	return s
+}
@@ -1,10 +1,15 @@
 package store
 
 import (
+	"context"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 )
 
+// Empty - хранилище, которое ничего не хранит: запись завершается без ошибок, а чтение, Stat и операции
+// над существующими файлами возвращают ErrNotExist, как другие хранилища для отсутствующего файла
 type Empty struct {
 }
 
@@ -12,50 +17,159 @@ func (l *Empty) init(cfg EmptyConfig) error {
 	return nil
 }
 
-func (l *Empty) IsExist(filePath string) bool {
+func (l *Empty) IsExistCtx(ctx context.Context, filePath string) bool {
 	return false
 }
 
+func (l *Empty) IsExist(filePath string) bool {
+	return l.IsExistCtx(context.Background(), filePath)
+}
+
+func (l *Empty) CreateFileCtx(ctx context.Context, path string, file []byte, meta map[string]string) error {
+	return nil
+}
+
 func (l *Empty) CreateFile(path string, file []byte, meta map[string]string) error {
+	return l.CreateFileCtx(context.Background(), path, file, meta)
+}
+
+func (l *Empty) StreamToFileCtx(ctx context.Context, stream io.Reader, path string) error {
 	return nil
 }
 
 func (l *Empty) StreamToFile(stream io.Reader, path string) error {
+	return l.StreamToFileCtx(context.Background(), stream, path)
+}
+
+func (l *Empty) StreamToFileWithMetaCtx(ctx context.Context, stream io.Reader, path string, meta map[string]string) error {
 	return nil
 }
 
-func (l *Empty) RemoveFile(path string) error {
+func (l *Empty) StreamToFileWithMeta(stream io.Reader, path string, meta map[string]string) error {
+	return l.StreamToFileWithMetaCtx(context.Background(), stream, path, meta)
+}
+
+func (l *Empty) GetMetaCtx(ctx context.Context, path string) (map[string]string, error) {
+	return nil, emptyError("getmeta", path)
+}
+
+func (l *Empty) GetMeta(path string) (map[string]string, error) {
+	return l.GetMetaCtx(context.Background(), path)
+}
+
+func (l *Empty) UpdateMetaCtx(ctx context.Context, path string, set map[string]string, unset []string) error {
+	return emptyError("updatemeta", path)
+}
+
+func (l *Empty) UpdateMeta(path string, set map[string]string, unset []string) error {
+	return l.UpdateMetaCtx(context.Background(), path, set, unset)
+}
+
+func (l *Empty) RemoveFileCtx(ctx context.Context, path string) error {
 	return nil
 }
 
+func (l *Empty) RemoveFile(path string) error {
+	return l.RemoveFileCtx(context.Background(), path)
+}
+
+func (l *Empty) GetFileCtx(ctx context.Context, path string) ([]byte, error) {
+	return nil, emptyError("open", path)
+}
+
 func (l *Empty) GetFile(path string) ([]byte, error) {
-	return nil, nil
+	return l.GetFileCtx(context.Background(), path)
+}
+
+func (l *Empty) GetFilePartiallyCtx(ctx context.Context, path string, offset, length int64) ([]byte, error) {
+	return nil, emptyError("open", path)
 }
 
 func (l *Empty) GetFilePartially(path string, offset, length int64) ([]byte, error) {
-	return nil, nil
+	return l.GetFilePartiallyCtx(context.Background(), path, offset, length)
+}
+
+func (l *Empty) FileReaderCtx(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	return nil, emptyError("open", path)
 }
 
 func (l *Empty) FileReader(path string, offset, length int64) (io.ReadCloser, error) {
-	return nil, nil
+	return l.FileReaderCtx(context.Background(), path, offset, length)
+}
+
+func (l *Empty) StatCtx(ctx context.Context, path string) (os.FileInfo, map[string]string, error) {
+	return nil, nil, emptyError("stat", path)
 }
 
 func (l *Empty) Stat(path string) (os.FileInfo, map[string]string, error) {
-	return nil, nil, nil
+	return l.StatCtx(context.Background(), path)
+}
+
+func (l *Empty) ClearDirCtx(ctx context.Context, dir string) error {
+	return nil
 }
 
 func (l *Empty) ClearDir(dir string) error {
+	return l.ClearDirCtx(context.Background(), dir)
+}
+
+func (l *Empty) MkdirAllCtx(ctx context.Context, path string) error {
 	return nil
 }
 
 func (l *Empty) MkdirAll(path string) error {
+	return l.MkdirAllCtx(context.Background(), path)
+}
+
+func (l *Empty) ReadDirCtx(ctx context.Context, path string) ([]os.FileInfo, error) {
+	return nil, nil
+}
+
+func (l *Empty) ReadDir(path string) ([]os.FileInfo, error) {
+	return l.ReadDirCtx(context.Background(), path)
+}
+
+func (l *Empty) WalkCtx(ctx context.Context, path string, fn filepath.WalkFunc) error {
 	return nil
 }
 
-func (l *Empty) CreateJsonFile(path string, data interface{}, meta map[string]string) error {
+func (l *Empty) Walk(path string, fn filepath.WalkFunc) error {
+	return l.WalkCtx(context.Background(), path, fn)
+}
+
+func (l *Empty) CreateJsonFileCtx(ctx context.Context, path string, data interface{}, meta map[string]string) error {
 	return nil
 }
 
+func (l *Empty) CreateJsonFile(path string, data interface{}, meta map[string]string) error {
+	return l.CreateJsonFileCtx(context.Background(), path, data, meta)
+}
+
+func (l *Empty) GetJsonFileCtx(ctx context.Context, path string, file interface{}) error {
+	return emptyError("open", path)
+}
+
 func (l *Empty) GetJsonFile(path string, file interface{}) error {
-	return nil
+	return l.GetJsonFileCtx(context.Background(), path, file)
+}
+
+func (l *Empty) CopyCtx(ctx context.Context, src, dst string) error {
+	return emptyError("copy", src)
+}
+
+func (l *Empty) Copy(src, dst string) error {
+	return l.CopyCtx(context.Background(), src, dst)
+}
+
+func (l *Empty) MoveCtx(ctx context.Context, src, dst string) error {
+	return emptyError("move", src)
+}
+
+func (l *Empty) Move(src, dst string) error {
+	return l.MoveCtx(context.Background(), src, dst)
+}
+
+// emptyError - возвращает ошибку отсутствующего файла в том же виде, что и пакет os
+func emptyError(op, path string) error {
+	return &fs.PathError{Op: op, Path: path, Err: ErrNotExist}
 }
@@ -0,0 +1,45 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vlkalashnikov/go-store"
+)
+
+// TestEmpty - проверяет, что Empty отличает отсутствующий файл от пустого
+func TestEmpty(t *testing.T) {
+	s, err := store.New(store.Config{StoreType: store.EmptyStore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateFile("file.txt", []byte("data"), nil); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	if _, err := s.GetFile("file.txt"); !errors.Is(err, store.ErrNotExist) {
+		t.Errorf("GetFile error = %v, want ErrNotExist", err)
+	}
+	if _, err := s.GetFilePartially("file.txt", 0, 1); !errors.Is(err, store.ErrNotExist) {
+		t.Errorf("GetFilePartially error = %v, want ErrNotExist", err)
+	}
+	if _, err := s.FileReader("file.txt", 0, 0); !errors.Is(err, store.ErrNotExist) {
+		t.Errorf("FileReader error = %v, want ErrNotExist", err)
+	}
+	var doc map[string]string
+	if err := s.GetJsonFile("file.txt", &doc); !errors.Is(err, store.ErrNotExist) {
+		t.Errorf("GetJsonFile error = %v, want ErrNotExist", err)
+	}
+	if _, _, err := s.Stat("file.txt"); !errors.Is(err, store.ErrNotExist) {
+		t.Errorf("Stat error = %v, want ErrNotExist", err)
+	}
+	if _, err := s.GetMeta("file.txt"); !errors.Is(err, store.ErrNotExist) {
+		t.Errorf("GetMeta error = %v, want ErrNotExist", err)
+	}
+	if err := s.UpdateMeta("file.txt", map[string]string{"author": "store"}, nil); !errors.Is(err, store.ErrNotExist) {
+		t.Errorf("UpdateMeta error = %v, want ErrNotExist", err)
+	}
+	if err := s.Copy("file.txt", "copy.txt"); !errors.Is(err, store.ErrNotExist) {
+		t.Errorf("Copy error = %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/studio-b12/gowebdav"
+)
+
+// Ошибки хранилища.
+// Ошибки всех хранилищ сопоставляются с ними, поэтому их можно проверять через errors.Is
+// независимо от типа хранилища. Исходная ошибка при этом сохраняется и доступна через errors.As.
+var (
+	// ErrNotExist - файл или директория не существует
+	ErrNotExist = fs.ErrNotExist
+	// ErrExist - файл или директория уже существует
+	ErrExist = fs.ErrExist
+	// ErrPermission - нет доступа
+	ErrPermission = fs.ErrPermission
+	// ErrInvalidRange - запрошенный диапазон выходит за пределы файла
+	ErrInvalidRange = errors.New("invalid range")
+	// ErrInvalidMeta - недопустимые метаданные или поврежденный мета-файл
+	ErrInvalidMeta = errors.New("invalid metadata")
+	// ErrUnknownCodec - кодек не задан и не найден по метаданным или расширению файла, см. Put и Get
+	ErrUnknownCodec = errors.New("unknown codec")
+	// ErrUnknownStore - хранилище с таким именем не зарегистрировано, см. Register
+	ErrUnknownStore = errors.New("unknown store type")
+	// ErrPresignNotConfigured - для хранилища не заданы PresignSecret и PresignBaseURL, см. PresignConfig
+	ErrPresignNotConfigured = errors.New("presign is not configured")
+)
+
+// storeError - ошибка хранилища, сопоставленная с одной из ошибок пакета
+type storeError struct {
+	kind error
+	err  error
+}
+
+func (e *storeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *storeError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// mapError - сопоставляет ошибку хранилища с ошибками пакета
+// err - исходная ошибка хранилища
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	kind := errorKind(err)
+	if kind == nil || errors.Is(err, kind) {
+		return err
+	}
+
+	return &storeError{kind: kind, err: err}
+}
+
+// errorKind - определяет, какой ошибке пакета соответствует ошибка хранилища
+func errorKind(err error) error {
+	for _, kind := range []error{ErrNotExist, ErrExist, ErrPermission, ErrInvalidRange} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == request.CanceledErrorCode {
+		// отмена контекста в aws-sdk-go не доступна через errors.Is
+		for _, ctxErr := range []error{context.Canceled, context.DeadlineExceeded} {
+			if errors.Is(awsErr.OrigErr(), ctxErr) {
+				return ctxErr
+			}
+		}
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		if kind := awsCodeKind(reqErr.Code()); kind != nil {
+			return kind
+		}
+		return statusKind(reqErr.StatusCode())
+	}
+
+	if awsErr != nil {
+		return awsCodeKind(awsErr.Code())
+	}
+
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		var statusErr gowebdav.StatusError
+		if errors.As(pathErr.Err, &statusErr) {
+			return statusKind(statusErr.Status)
+		}
+	}
+
+	return nil
+}
+
+// awsCodeKind - сопоставляет код ошибки AWS с ошибкой пакета
+func awsCodeKind(code string) error {
+	switch code {
+	case "NotFound", "NoSuchKey", "NoSuchBucket", "NoSuchUpload":
+		return ErrNotExist
+	case "AccessDenied", "Forbidden", "AllAccessDisabled":
+		return ErrPermission
+	case "InvalidRange":
+		return ErrInvalidRange
+	case "PreconditionFailed", "BucketAlreadyExists", "BucketAlreadyOwnedByYou":
+		return ErrExist
+	}
+	return nil
+}
+
+// statusKind - сопоставляет HTTP статус ответа с ошибкой пакета
+func statusKind(status int) error {
+	switch status {
+	case http.StatusNotFound, http.StatusGone:
+		return ErrNotExist
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrPermission
+	case http.StatusRequestedRangeNotSatisfiable:
+		return ErrInvalidRange
+	case http.StatusPreconditionFailed:
+		return ErrExist
+	}
+	return nil
+}
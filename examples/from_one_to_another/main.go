@@ -11,7 +11,8 @@ import (
 )
 
 const (
-	_S3Bucket      = "/my-bucket"
+	_S3Bucket      = "my-bucket"
+	_S3Prefix      = "examples"
 	_S3Region      = "eu-central-1"
 	_S3AccessId    = "hdCTitOcGEr9rNw65Uo2"
 	_S3AccessKey   = "gHl2y24YYHJQi1rrsjJmgTL2psN88JGeJRkL6ShZ"
@@ -58,6 +59,7 @@ func main() {
 func fromS3ToLocal() {
 	s3Store, _ := store.NewS3(store.S3Config{
 		S3Bucket: _S3Bucket,
+		S3Prefix: _S3Prefix,
 		Config: aws.Config{
 			Region:      aws.String(_S3Region),
 			Credentials: credentials.NewStaticCredentials(_S3AccessId, _S3AccessKey, _S3AccessToken),
@@ -86,6 +88,7 @@ func fromLocalToS3() {
 
 	s3Store, _ := store.NewS3(store.S3Config{
 		S3Bucket: _S3Bucket,
+		S3Prefix: _S3Prefix,
 		Config: aws.Config{
 			Region:      aws.String(_S3Region),
 			Credentials: credentials.NewStaticCredentials(_S3AccessId, _S3AccessKey, _S3AccessToken),
@@ -154,6 +157,7 @@ func fromLocalToWebDav() {
 func fromS3ToWebDav() {
 	s3Store, _ := store.NewS3(store.S3Config{
 		S3Bucket: _S3Bucket,
+		S3Prefix: _S3Prefix,
 		Config: aws.Config{
 			Region:      aws.String(_S3Region),
 			Credentials: credentials.NewStaticCredentials(_S3AccessId, _S3AccessKey, _S3AccessToken),
@@ -190,6 +194,7 @@ func fromWebDavToS3() {
 
 	s3Store, _ := store.NewS3(store.S3Config{
 		S3Bucket: _S3Bucket,
+		S3Prefix: _S3Prefix,
 		Config: aws.Config{
 			Region:      aws.String(_S3Region),
 			Credentials: credentials.NewStaticCredentials(_S3AccessId, _S3AccessKey, _S3AccessToken),
@@ -214,6 +219,7 @@ func fromWebDavToS3() {
 func fromS3ToWebDavPartially() {
 	s3Store, _ := store.NewS3(store.S3Config{
 		S3Bucket: _S3Bucket,
+		S3Prefix: _S3Prefix,
 		Config: aws.Config{
 			Region:      aws.String(_S3Region),
 			Credentials: credentials.NewStaticCredentials(_S3AccessId, _S3AccessKey, _S3AccessToken),
@@ -11,7 +11,8 @@ import (
 )
 
 const (
-	_S3Bucket      = "/my-bucket"
+	_S3Bucket      = "my-bucket"
+	_S3Prefix      = "examples"
 	_S3Region      = "eu-central-1"
 	_S3AccessId    = "hdCTitOcGEr9rNw65Uo2"
 	_S3AccessKey   = "gHl2y24YYHJQi1rrsjJmgTL2psN88JGeJRkL6ShZ"
@@ -27,6 +28,7 @@ var choice int
 func main() {
 	s, _ := store.NewS3(store.S3Config{
 		S3Bucket: _S3Bucket,
+		S3Prefix: _S3Prefix,
 		Config: aws.Config{
 			Region:      aws.String(_S3Region),
 			Credentials: credentials.NewStaticCredentials(_S3AccessId, _S3AccessKey, _S3AccessToken),
@@ -91,11 +93,11 @@ func streamToFile(s store.StoreIFace, file string) {
 }
 
 func stat(s store.StoreIFace, file string) {
-	_, meta, err := s.Stat(file)
+	info, meta, err := s.Stat(file)
 	if err != nil {
 		panic(err)
 	}
 
-	//fmt.Printf("Size: %d\n", info.Size()) // info.Size() is not available for S3
+	fmt.Printf("Size: %d\n", info.Size())
 	fmt.Printf("Meta: %v\n", meta)
 }
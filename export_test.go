@@ -0,0 +1,11 @@
+package store
+
+// SetS3CopyLimits - заменяет предел размера CopyObject и размер части копирования S3,
+// чтобы проверить копирование по частям на небольших объектах. Возвращает функцию восстановления
+func SetS3CopyLimits(maxObjectSize, partSize int64) (restore func()) {
+	prevMax, prevPart := maxCopyObjectSize, copyPartSize
+	maxCopyObjectSize, copyPartSize = maxObjectSize, partSize
+	return func() {
+		maxCopyObjectSize, copyPartSize = prevMax, prevPart
+	}
+}
@@ -4,10 +4,17 @@ go 1.20
 
 require (
 	github.com/aws/aws-sdk-go v1.54.11
+	github.com/fxamacker/cbor/v2 v2.7.0
 	github.com/studio-b12/gowebdav v0.9.0
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	golang.org/x/net v0.11.0
+	google.golang.org/protobuf v1.34.2
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
-	golang.org/x/net v0.11.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/text v0.10.0 // indirect
 )
@@ -0,0 +1,332 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	pathpkg "path"
+	"strconv"
+	"strings"
+)
+
+// META_CONTENT_TYPE - ключ метаданных с MIME-типом файла, который NewHandler отдает в Content-Type
+const META_CONTENT_TYPE = "content-type"
+
+// NewHandler - возвращает http.Handler, который отдает файлы хранилища: GET и HEAD, один или несколько Range
+// (multipart/byteranges), Content-Length, Last-Modified, ETag и условные запросы (If-Modified-Since, If-None-Match и др.).
+// Путь запроса - путь к файлу, поэтому если handler обслуживает не корень сайта, он монтируется через http.StripPrefix.
+// Content-Type берется из метаданных (META_CONTENT_TYPE, кодек META_CODEC), иначе по расширению файла.
+// Директории и несуществующие файлы отдаются с 404
+// s - хранилище
+func NewHandler(s StoreIFace) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		serveFile(w, r, s, strings.TrimPrefix(pathpkg.Clean("/"+r.URL.Path), "/"))
+	})
+}
+
+// serveFile - отдает файл хранилища через http.ServeContent: GET и HEAD, Range, Last-Modified, ETag и условные запросы
+// w - ответ
+// r - запрос
+// s - хранилище
+// path - путь к файлу
+func serveFile(w http.ResponseWriter, r *http.Request, s StoreCtxIFace, path string) {
+	ctx := r.Context()
+	info, meta, err := stat(ctx, s, path)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	if info.IsDir() {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	if contentType := contentType(path, meta); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	if etag := fileETag(info); etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+
+	content := &fileReadSeeker{ctx: ctx, s: s, path: path, size: info.Size(), ranges: parseRanges(r.Header.Get("Range"), info.Size())}
+	defer content.Close()
+	http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+}
+
+// stat - вызывает StatCtx хранилища. Если хранилище не вернуло ни информации о файле, ни ошибки,
+// возвращается ErrNotExist, поэтому сторонние хранилища не приводят к разыменованию nil
+func stat(ctx context.Context, s StoreCtxIFace, path string) (os.FileInfo, map[string]string, error) {
+	info, meta, err := s.StatCtx(ctx, path)
+	if err == nil && info == nil {
+		err = &fs.PathError{Op: "stat", Path: path, Err: ErrNotExist}
+	}
+	return info, meta, err
+}
+
+// statEntry - возвращает информацию о файле или директории path.
+// Корень хранилища существует всегда. S3 не умеет Stat для префиксов (директорий),
+// поэтому если Stat не нашел path, директория ищется в списке родительской директории
+func statEntry(ctx context.Context, s StoreCtxIFace, path string) (os.FileInfo, error) {
+	if isRoot(path) {
+		return &File{name: ".", isdir: true}, nil
+	}
+
+	info, _, err := stat(ctx, s, path)
+	if !errors.Is(err, ErrNotExist) {
+		return info, err
+	}
+	entries, listErr := s.ReadDirCtx(ctx, pathpkg.Dir(path))
+	if listErr != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() == pathpkg.Base(path) {
+			return entry, nil
+		}
+	}
+	return nil, err
+}
+
+// contentType - возвращает MIME-тип файла из метаданных или по расширению.
+// Пустая строка означает, что тип определит http.ServeContent по содержимому
+func contentType(path string, meta map[string]string) string {
+	if contentType := meta[META_CONTENT_TYPE]; contentType != "" {
+		return contentType
+	}
+	if codec, ok := CodecByName(meta[META_CODEC]); ok {
+		return codec.ContentType()
+	}
+	return mime.TypeByExtension(pathpkg.Ext(path))
+}
+
+// fileETag - возвращает ETag файла, построенный из размера и времени изменения, как у nginx.
+// Если время изменения неизвестно, ETag не формируется
+func fileETag(info os.FileInfo) string {
+	if info.ModTime().IsZero() {
+		return ""
+	}
+	return `"` + strconv.FormatInt(info.ModTime().UnixNano(), 16) + "-" + strconv.FormatInt(info.Size(), 16) + `"`
+}
+
+// httpError - отвечает HTTP статусом, соответствующим ошибке хранилища
+func httpError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrNotExist):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrPermission), errors.Is(err, ErrOutsideRoot):
+		status = http.StatusForbidden
+	case errors.Is(err, ErrInvalidRange):
+		status = http.StatusRequestedRangeNotSatisfiable
+	case errors.Is(err, ErrInvalidMeta):
+		status = http.StatusBadRequest
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+// byteRange - диапазон байт [start, end) из заголовка Range
+type byteRange struct {
+	start, end int64
+}
+
+// parseRanges - разбирает заголовок Range для файла размера size.
+// Результат используется только как подсказка fileReadSeeker, сам запрос проверяет http.ServeContent,
+// поэтому при любой ошибке возвращается nil
+func parseRanges(header string, size int64) []byteRange {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil
+	}
+
+	var ranges []byteRange
+	for _, part := range strings.Split(spec, ",") {
+		first, last, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok {
+			return nil
+		}
+		var rng byteRange
+		if first == "" {
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil
+			}
+			rng = byteRange{start: size - n, end: size}
+			if rng.start < 0 {
+				rng.start = 0
+			}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil
+			}
+			rng = byteRange{start: start, end: size}
+			if last != "" {
+				end, err := strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil
+				}
+				if end+1 < size {
+					rng.end = end + 1
+				}
+			}
+		}
+		if rng.start < rng.end {
+			ranges = append(ranges, rng)
+		}
+	}
+	return ranges
+}
+
+// fileReadSeeker - io.ReadSeeker поверх FileReaderCtx для http.ServeContent.
+// Seek только запоминает смещение, поток с нужного смещения открывается при следующем Read,
+// поэтому определение размера файла через Seek не читает данные.
+// Если смещение попадает в один из запрошенных диапазонов ranges, поток открывается с длиной до конца диапазона,
+// и хранилище не передает лишние данные
+type fileReadSeeker struct {
+	ctx     context.Context
+	s       StoreCtxIFace
+	path    string
+	size    int64
+	ranges  []byteRange
+	offset  int64
+	stream  io.ReadCloser
+	limited bool
+}
+
+func (f *fileReadSeeker) Read(p []byte) (int, error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	if f.stream == nil {
+		var length int64
+		for _, rng := range f.ranges {
+			if f.offset >= rng.start && f.offset < rng.end {
+				length = rng.end - f.offset
+				break
+			}
+		}
+		stream, err := f.s.FileReaderCtx(f.ctx, f.path, f.offset, length)
+		if err != nil {
+			return 0, err
+		}
+		f.stream = stream
+		f.limited = length > 0
+	}
+
+	n, err := f.stream.Read(p)
+	f.offset += int64(n)
+	if err == io.EOF && f.limited && f.offset < f.size {
+		// диапазон прочитан, но ServeContent читает дальше - следующий Read откроет поток заново
+		f.Close()
+		err = nil
+	}
+	return n, err
+}
+
+func (f *fileReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	}
+	if offset < 0 {
+		return 0, ErrInvalidRange
+	}
+
+	if offset != f.offset {
+		f.Close()
+		f.offset = offset
+	}
+	return offset, nil
+}
+
+func (f *fileReadSeeker) Close() error {
+	if f.stream == nil {
+		return nil
+	}
+	err := f.stream.Close()
+	f.stream = nil
+	return err
+}
+
+// NewFileSystem - возвращает http.FileSystem поверх хранилища для http.FileServer и других пакетов,
+// которые работают с http.FileSystem. Чтение файлов идет через FileReader, поэтому Seek не загружает файл целиком.
+// В отличие от NewHandler, Content-Type определяется http.FileServer по расширению и содержимому файла
+// s - хранилище
+func NewFileSystem(s StoreIFace) http.FileSystem {
+	return httpFileSystem{s: s}
+}
+
+type httpFileSystem struct {
+	s StoreIFace
+}
+
+func (fsys httpFileSystem) Open(name string) (http.File, error) {
+	path := pathpkg.Clean(strings.TrimPrefix(pathpkg.Clean("/"+name), "/"))
+	ctx := context.Background()
+	info, err := statEntry(ctx, fsys.s, path)
+	if err != nil {
+		return nil, err
+	}
+	return &httpFile{fileReadSeeker: fileReadSeeker{ctx: ctx, s: fsys.s, path: path, size: info.Size()}, info: info}, nil
+}
+
+// httpFile - http.File поверх файла или директории хранилища
+type httpFile struct {
+	fileReadSeeker
+	info    os.FileInfo
+	entries []os.FileInfo
+	read    bool
+}
+
+func (f *httpFile) Read(p []byte) (int, error) {
+	if f.info.IsDir() {
+		return 0, &os.PathError{Op: "read", Path: f.path, Err: errors.New("is a directory")}
+	}
+	return f.fileReadSeeker.Read(p)
+}
+
+// Readdir - возвращает записи директории по правилам os.File.Readdir
+func (f *httpFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.info.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: f.path, Err: errors.New("not a directory")}
+	}
+	if !f.read {
+		entries, err := f.s.ReadDirCtx(f.ctx, f.path)
+		if err != nil {
+			return nil, err
+		}
+		f.entries = entries
+		f.read = true
+	}
+
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := count
+	if n > len(f.entries) {
+		n = len(f.entries)
+	}
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
+
+func (f *httpFile) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
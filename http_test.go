@@ -0,0 +1,252 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vlkalashnikov/go-store"
+)
+
+func TestHandlerMemory(t *testing.T) {
+	testHandler(t, newMemory(t))
+}
+
+func TestHandlerLocal(t *testing.T) {
+	s, err := store.NewLocal(store.LocalConfig{Root: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testHandler(t, s)
+}
+
+func TestHandlerS3(t *testing.T) {
+	testHandler(t, newS3(t, newFakeS3(t), store.S3Config{}))
+}
+
+// TestHandlerRanges - проверяет, что диапазоны читаются через FileReader с нужными смещением и длиной
+func TestHandlerRanges(t *testing.T) {
+	s := &readerLog{StoreIFace: newMemory(t)}
+	if err := s.CreateFile("file.bin", []byte("0123456789abcdefghij"), nil); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(store.NewHandler(s))
+	t.Cleanup(srv.Close)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/file.bin", nil)
+	req.Header.Set("Range", "bytes=2-4, 10-11")
+	doRequest(t, req, http.StatusPartialContent)
+
+	if got, want := strings.Join(s.calls, " "), "2+3 10+2"; got != want {
+		t.Fatalf("FileReader calls = %s, want %s", got, want)
+	}
+}
+
+// TestFileSystem - проверяет http.FileServer поверх NewFileSystem
+func TestFileSystemMemory(t *testing.T) {
+	testFileSystem(t, newMemory(t))
+}
+
+// TestFileSystemS3 - директории S3 существуют только как префиксы ключей
+func TestFileSystemS3(t *testing.T) {
+	testFileSystem(t, newS3(t, newFakeS3(t), store.S3Config{}))
+}
+
+// TestHandlerEmpty - Empty не хранит файлы, обработчик отвечает 404
+func TestHandlerEmpty(t *testing.T) {
+	s, err := store.New(store.Config{StoreType: store.EmptyStore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range []http.Handler{store.NewHandler(s), http.FileServer(store.NewFileSystem(s))} {
+		srv := httptest.NewServer(h)
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/file.txt", nil)
+		doRequest(t, req, http.StatusNotFound)
+		srv.Close()
+	}
+}
+
+func testFileSystem(t *testing.T, s store.StoreIFace) {
+	if err := s.MkdirAll("dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateFile("dir/file.txt", []byte("0123456789"), nil); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.FileServer(store.NewFileSystem(s)))
+	t.Cleanup(srv.Close)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/dir/file.txt", nil)
+	req.Header.Set("Range", "bytes=3-5")
+	if body := doRequest(t, req, http.StatusPartialContent); body != "345" {
+		t.Fatalf("GET Range = %q, want 345", body)
+	}
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/dir/", nil)
+	if body := doRequest(t, req, http.StatusOK); !strings.Contains(body, `href="file.txt"`) {
+		t.Fatalf("directory listing = %q", body)
+	}
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/", nil)
+	if body := doRequest(t, req, http.StatusOK); !strings.Contains(body, `href="dir/"`) {
+		t.Fatalf("root listing = %q", body)
+	}
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/missing.txt", nil)
+	doRequest(t, req, http.StatusNotFound)
+}
+
+// testHandler - проверяет NewHandler: Content-Type, Range, условные запросы и HEAD
+func testHandler(t *testing.T, s store.StoreIFace) {
+	srv := httptest.NewServer(http.StripPrefix("/files", store.NewHandler(s)))
+	t.Cleanup(srv.Close)
+	if err := s.MkdirAll("dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateFile("dir/file.txt", []byte("0123456789"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateFile("report", []byte("%PDF"), map[string]string{store.META_CONTENT_TYPE: "application/pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(s, "doc", map[string]int{"count": 1}, nil, store.WithCodec(mustCodec(t, "yaml"))); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := get(t, srv.URL+"/files/dir/file.txt", nil)
+	if body := readBody(t, resp, http.StatusOK); body != "0123456789" {
+		t.Fatalf("GET = %q", body)
+	}
+	if resp.ContentLength != 10 || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("GET Content-Length = %d, Content-Type = %q", resp.ContentLength, resp.Header.Get("Content-Type"))
+	}
+	etag, modified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" || modified == "" {
+		t.Fatalf("GET ETag = %q, Last-Modified = %q", etag, modified)
+	}
+
+	for path, want := range map[string]string{"report": "application/pdf", "doc": "application/yaml"} {
+		if got := get(t, srv.URL+"/files/"+path, nil).Header.Get("Content-Type"); got != want {
+			t.Errorf("Content-Type of %s = %q, want %q", path, got, want)
+		}
+	}
+
+	resp = get(t, srv.URL+"/files/dir/file.txt", http.Header{"Range": {"bytes=2-5"}})
+	if body := readBody(t, resp, http.StatusPartialContent); body != "2345" || resp.Header.Get("Content-Range") != "bytes 2-5/10" {
+		t.Fatalf("GET Range = %q, Content-Range %q", body, resp.Header.Get("Content-Range"))
+	}
+	resp = get(t, srv.URL+"/files/dir/file.txt", http.Header{"Range": {"bytes=20-"}})
+	readBody(t, resp, http.StatusRequestedRangeNotSatisfiable)
+
+	resp = get(t, srv.URL+"/files/dir/file.txt", http.Header{"Range": {"bytes=0-1,-2"}})
+	readBody(t, resp, http.StatusPartialContent)
+	if parts := multipartBody(t, resp); strings.Join(parts, ",") != "01,89" {
+		t.Fatalf("multi-range parts = %q, want [01 89]", parts)
+	}
+
+	resp = get(t, srv.URL+"/files/dir/file.txt", http.Header{"If-None-Match": {etag}})
+	readBody(t, resp, http.StatusNotModified)
+	resp = get(t, srv.URL+"/files/dir/file.txt", http.Header{"If-Modified-Since": {modified}})
+	readBody(t, resp, http.StatusNotModified)
+	resp = get(t, srv.URL+"/files/dir/file.txt", http.Header{"If-Match": {`"other"`}})
+	readBody(t, resp, http.StatusPreconditionFailed)
+	resp = get(t, srv.URL+"/files/dir/file.txt", http.Header{"Range": {"bytes=0-1"}, "If-Range": {`"other"`}})
+	if body := readBody(t, resp, http.StatusOK); body != "0123456789" {
+		t.Fatalf("GET If-Range mismatch = %q, want full file", body)
+	}
+
+	req, _ := http.NewRequest(http.MethodHead, srv.URL+"/files/dir/file.txt", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := readBody(t, resp, http.StatusOK); body != "" || resp.ContentLength != 10 {
+		t.Fatalf("HEAD body = %q, Content-Length = %d", body, resp.ContentLength)
+	}
+
+	req, _ = http.NewRequest(http.MethodPut, srv.URL+"/files/dir/file.txt", strings.NewReader("new"))
+	doRequest(t, req, http.StatusMethodNotAllowed)
+	readBody(t, get(t, srv.URL+"/files/dir/missing.txt", nil), http.StatusNotFound)
+}
+
+// readerLog - хранилище, которое записывает смещение и длину вызовов FileReaderCtx
+type readerLog struct {
+	store.StoreIFace
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *readerLog) FileReaderCtx(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	r.mu.Lock()
+	r.calls = append(r.calls, fmt.Sprintf("%d+%d", offset, length))
+	r.mu.Unlock()
+	return r.StoreIFace.FileReaderCtx(ctx, path, offset, length)
+}
+
+func mustCodec(t *testing.T, name string) store.Codec {
+	t.Helper()
+	codec, ok := store.CodecByName(name)
+	if !ok {
+		t.Fatalf("codec %q not registered", name)
+	}
+	return codec
+}
+
+func get(t *testing.T, url string, header http.Header) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// readBody - проверяет статус ответа и возвращает тело. Тело multipart ответа остается непрочитанным
+func readBody(t *testing.T, resp *http.Response, status int) string {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Fatalf("%s %s: status %d, want %d", resp.Request.Method, resp.Request.URL, resp.StatusCode, status)
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "multipart/") {
+		return ""
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// multipartBody - возвращает части ответа multipart/byteranges
+func multipartBody(t *testing.T, resp *http.Response) []string {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("Content-Type = %q", resp.Header.Get("Content-Type"))
+	}
+	var parts []string
+	reader := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, string(body))
+	}
+}
@@ -1,11 +1,16 @@
 package store
 
 import (
-	"bytes"
-	"errors"
-	"fmt"
+	"context"
 	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 )
@@ -15,18 +20,48 @@ const (
 	WebDavStore = "webdav"
 	S3Store     = "s3"
 	EmptyStore  = "empty"
+	MemoryStore = "memory"
 	perm        = 0777
 	META_PREFIX = ".meta"
+	TEMP_SUFFIX = ".tmp"
 )
 
 type StoreConfigIFace interface {
-	aws.Config | WebDavConfig | EmptyConfig | LocalConfig
+	aws.Config | WebDavConfig | EmptyConfig | LocalConfig | MemoryConfig
 }
 
+// StoreCtxIFace - интерфейс хранилища, методы которого принимают контекст.
+// Отмена контекста или истечение его дедлайна прерывает сетевые запросы и циклы копирования.
+type StoreCtxIFace interface {
+	IsExistCtx(context.Context, string) bool
+	CreateFileCtx(context.Context, string, []byte, map[string]string) error
+	StreamToFileCtx(ctx context.Context, stream io.Reader, path string) error
+	StreamToFileWithMetaCtx(ctx context.Context, stream io.Reader, path string, meta map[string]string) error
+	GetFileCtx(ctx context.Context, path string) ([]byte, error)
+	GetFilePartiallyCtx(ctx context.Context, path string, offset, length int64) ([]byte, error)
+	FileReaderCtx(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error)
+	RemoveFileCtx(ctx context.Context, path string) error
+	CreateJsonFileCtx(context.Context, string, interface{}, map[string]string) error
+	ClearDirCtx(context.Context, string) error
+	GetJsonFileCtx(context.Context, string, interface{}) error
+	StatCtx(context.Context, string) (os.FileInfo, map[string]string, error)
+	GetMetaCtx(ctx context.Context, path string) (map[string]string, error)
+	UpdateMetaCtx(ctx context.Context, path string, set map[string]string, unset []string) error
+	MkdirAllCtx(context.Context, string) error
+	ReadDirCtx(context.Context, string) ([]os.FileInfo, error)
+	WalkCtx(context.Context, string, filepath.WalkFunc) error
+	CopyCtx(ctx context.Context, src, dst string) error
+	MoveCtx(ctx context.Context, src, dst string) error
+}
+
+// StoreIFace - интерфейс хранилища.
+// Методы без контекста являются обертками над методами StoreCtxIFace с context.Background()
 type StoreIFace interface {
+	StoreCtxIFace
 	IsExist(string) bool
 	CreateFile(string, []byte, map[string]string) error
 	StreamToFile(stream io.Reader, path string) error
+	StreamToFileWithMeta(stream io.Reader, path string, meta map[string]string) error
 	GetFile(path string) ([]byte, error)
 	GetFilePartially(path string, offset, length int64) ([]byte, error)
 	FileReader(path string, offset, length int64) (io.ReadCloser, error)
@@ -35,7 +70,13 @@ type StoreIFace interface {
 	ClearDir(string) error
 	GetJsonFile(string, interface{}) error
 	Stat(string) (os.FileInfo, map[string]string, error)
+	GetMeta(path string) (map[string]string, error)
+	UpdateMeta(path string, set map[string]string, unset []string) error
 	MkdirAll(string) error
+	ReadDir(string) ([]os.FileInfo, error)
+	Walk(string, filepath.WalkFunc) error
+	Copy(src, dst string) error
+	Move(src, dst string) error
 }
 
 type Config struct {
@@ -44,10 +85,23 @@ type Config struct {
 	LocalConfig  LocalConfig
 	WebDavConfig WebDavConfig
 	S3Config     S3Config
+	MemoryConfig MemoryConfig
+	// URL - конфигурация в виде URL для хранилищ, зарегистрированных через Register.
+	// ConfigFromURL заполняет его для любой схемы
+	URL *url.URL
 }
 
 type S3Config struct {
 	S3Bucket string
+	// S3Prefix - префикс ключей, внутри которого работает хранилище
+	S3Prefix string
+	// S3PartSize - размер части при загрузке потока (StreamToFile), по умолчанию и не меньше 5MB.
+	// Для очень больших потоков и потоков неизвестной длины размер части увеличивается автоматически
+	S3PartSize int64
+	// S3Concurrency - количество частей, загружаемых одновременно, по умолчанию 4
+	S3Concurrency int
+	// S3MemoryBudget - максимальный объем памяти под буферы частей, по умолчанию S3PartSize * S3Concurrency
+	S3MemoryBudget int64
 	aws.Config
 }
 
@@ -55,24 +109,45 @@ type WebDavConfig struct {
 	WebDavHost string
 	WebDavUser string
 	WebDavPass string
+	// WebDavRoot - директория на сервере, внутри которой работает хранилище
+	WebDavRoot string
+	// WebDavAtomicWrites - записывать файлы во временный файл и затем переименовывать (MOVE),
+	// чтобы читатели не видели частично записанный файл
+	WebDavAtomicWrites bool
+	// WebDavPropMeta - хранить метаданные в мертвых свойствах файла (PROPPATCH) в пространстве имен go-store вместо мета-файлов.
+	// Для серверов без поддержки PROPPATCH используются мета-файлы (значение по умолчанию)
+	WebDavPropMeta bool
+	// WebDavConcurrency - количество одновременных запросов DELETE в ClearDir и RemoveDir, по умолчанию 4
+	WebDavConcurrency int
+	// WebDavHTTPClient - HTTP-клиент, транспорт (TLS, прокси), таймаут и cookie которого используются во всех запросах.
+	// По умолчанию http.Client с http.DefaultTransport
+	WebDavHTTPClient *http.Client
+	// PresignConfig - параметры ссылок PresignGet и PresignPut
+	PresignConfig
 }
 
 type EmptyConfig struct{}
-type LocalConfig struct{}
 
+type LocalConfig struct {
+	// Root - директория, внутри которой работает хранилище.
+	// Если не задана, пути используются как есть
+	Root string
+	// XattrMeta - хранить метаданные в расширенных атрибутах user.go-store.* (Linux) вместо мета-файлов.
+	// Если файловая система не поддерживает расширенные атрибуты (ENOTSUP), используются мета-файлы
+	XattrMeta bool
+	// PresignConfig - параметры ссылок PresignGet и PresignPut
+	PresignConfig
+}
+type MemoryConfig struct{}
+
+// New - создает хранилище типа cfg.StoreType через зарегистрированную функцию создания, см. Register.
+// Если тип не зарегистрирован, возвращается ErrUnknownStore
 func New(cfg Config) (StoreIFace, error) {
-	switch cfg.StoreType {
-	case LocalStore:
-		return NewLocal(cfg.LocalConfig)
-	case WebDavStore:
-		return NewWebDav(cfg.WebDavConfig)
-	case S3Store:
-		return NewS3(cfg.S3Config)
-	case EmptyStore:
-		return NewEmpty(cfg.EmptyConfig)
-	default:
-		return nil, errors.New("unknown store type")
+	factory, err := lookupBackend(cfg.StoreType)
+	if err != nil {
+		return nil, err
 	}
+	return factory(cfg)
 }
 
 func NewEmpty(cfg EmptyConfig) (StoreIFace, error) {
@@ -83,6 +158,14 @@ func NewEmpty(cfg EmptyConfig) (StoreIFace, error) {
 	return s, nil
 }
 
+func NewMemory(cfg MemoryConfig) (StoreIFace, error) {
+	s := new(Memory)
+	if err := s.init(cfg); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
 func NewLocal(cfg LocalConfig) (StoreIFace, error) {
 	s := new(Local)
 	if err := s.init(cfg); err != nil {
@@ -110,32 +193,171 @@ func NewS3(cfg S3Config) (StoreIFace, error) {
 // Что такое метаданные файла и для чего они нужны?
 // Метаданные файла - это информация о файле, которая не является его содержимым.
 // Данная информация является дополнительной, на усмотрение разработчика.
-// Т.к AWS S3 поддерживает метаданные из коробки, то для остальных хранилищ их приходится хранить в отдельном файле.
-// Мета-файл создается вместе с основным файлом и имеет расширение .meta
-// Для хранения метаданных используется формат key=value, где key - название метаданных, value - значение метаданных
+// AWS S3 хранит метаданные вместе с объектом, Memory - вместе с содержимым файла.
+// Local и WebDav по умолчанию хранят их в мета-файле с расширением .meta рядом с основным файлом.
+// Мета-файл создается, только если файл записан с метаданными, и содержит JSON с маркером формата
+// "go-store/meta" и версией, см. meta2Bytes. Формат key=value по одной паре в строке только читается
+// для совместимости с мета-файлами, записанными прежними версиями.
+// Вместо мета-файлов Local с XattrMeta хранит метаданные в расширенных атрибутах user.go-store.*,
+// а WebDav с WebDavPropMeta - в мертвых свойствах (dead properties) самого файла.
 // При удалении основного файла, удаляется и мета-файл
 
-// meta2Bytes - преобразует метаданные в байты
-func meta2Bytes(meta map[string]string) []byte {
-	b := new(bytes.Buffer)
-	for key, value := range meta {
-		fmt.Fprintf(b, "%s=%s\n", key, value)
+// isMetaFile - проверяет, является ли файл мета-файлом
+// name - имя или путь файла
+func isMetaFile(name string) bool {
+	return strings.HasSuffix(name, META_PREFIX)
+}
+
+// tempMarker - часть имени временного файла, отличающая его от пользовательских файлов
+const tempMarker = ".go-store-"
+
+// tempName - возвращает имя временного файла для атомарной записи в ту же директорию, что и path.
+// Имя имеет вид ".<name>.go-store-<rand>.tmp", такие файлы не возвращаются в ReadDir и Walk
+// p - путь к файлу
+func tempName(p string) string {
+	dir, name := filepath.Split(p)
+	return dir + "." + name + tempMarker + strconv.FormatUint(rand.Uint64(), 36) + TEMP_SUFFIX
+}
+
+// isTempFile - проверяет, является ли файл временным файлом атомарной записи
+// name - имя или путь файла
+func isTempFile(name string) bool {
+	name = path.Base(filepath.ToSlash(name))
+	if !strings.HasPrefix(name, ".") || !strings.HasSuffix(name, TEMP_SUFFIX) {
+		return false
 	}
-	return b.Bytes()
+	i := strings.LastIndex(name, tempMarker)
+	if i <= 0 {
+		return false
+	}
+	_, err := strconv.ParseUint(strings.TrimSuffix(name[i+len(tempMarker):], TEMP_SUFFIX), 36, 64)
+	return err == nil
 }
 
-// bytes2Meta - преобразует байты в метаданные
-func bytes2Meta(b []byte) map[string]string {
-	meta := make(map[string]string)
-	for _, line := range bytes.Split(b, []byte{'\n'}) {
-		if len(line) == 0 {
-			continue
+// isServiceFile - проверяет, является ли файл служебным: мета-файлом или временным файлом атомарной записи.
+// Файл X.meta считается мета-файлом, только если рядом с ним есть файл X,
+// поэтому пользовательские файлы с расширением .meta не скрываются из ReadDir и Walk
+// name - имя или путь файла
+// exists - проверяет, существует ли файл с именем или путем
+func isServiceFile(name string, exists func(string) bool) bool {
+	if isTempFile(name) {
+		return true
+	}
+	return isMetaFile(name) && exists(strings.TrimSuffix(name, META_PREFIX))
+}
+
+// walk - рекурсивно обходит дерево директорий, аналогично filepath.Walk
+// ctx - контекст, при отмене которого обход прерывается
+// root - путь к корню обхода
+// info - информация о корне обхода
+// readDir - функция чтения содержимого директории
+// fn - функция, вызываемая для каждого файла и директории
+func walk(ctx context.Context, root string, info os.FileInfo, readDir func(string) ([]os.FileInfo, error), fn filepath.WalkFunc) error {
+	err := walkTree(root, info, readDir, walkFuncCtx(ctx, fn))
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func walkTree(p string, info os.FileInfo, readDir func(string) ([]os.FileInfo, error), fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(p, info, nil)
+	}
+
+	infos, err := readDir(p)
+	err1 := fn(p, info, err)
+	if err != nil || err1 != nil {
+		return err1
+	}
+
+	for _, fi := range infos {
+		err = walkTree(path.Join(p, fi.Name()), fi, readDir, fn)
+		if err != nil {
+			if !fi.IsDir() || err != filepath.SkipDir {
+				return err
+			}
 		}
-		pair := bytes.Split(line, []byte{'='})
-		if len(pair) != 2 {
-			continue
+	}
+	return nil
+}
+
+// walkFuncCtx - оборачивает fn так, что обход прерывается при отмене контекста
+func walkFuncCtx(ctx context.Context, fn filepath.WalkFunc) filepath.WalkFunc {
+	return func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
 		}
-		meta[string(pair[0])] = string(pair[1])
+		return fn(path, info, err)
+	}
+}
+
+// ctxReader - io.Reader, который перестает читать после отмены контекста
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// ctxReadCloser - io.ReadCloser, который перестает читать после отмены контекста
+type ctxReadCloser struct {
+	ctxReader
+	io.Closer
+}
+
+func newCtxReadCloser(ctx context.Context, rc io.ReadCloser) io.ReadCloser {
+	return &ctxReadCloser{ctxReader{ctx, rc}, rc}
+}
+
+// sectionReadCloser - io.ReadCloser для части файла,
+// который также реализует io.ReaderAt и io.Seeker для произвольного доступа в пределах этой части
+type sectionReadCloser struct {
+	*io.SectionReader
+	ctx    context.Context
+	closer io.Closer
+}
+
+// newSectionReadCloser - возвращает reader для части файла
+// ctx - контекст, при отмене которого чтение прерывается
+// r - источник данных
+// closer - закрывает источник, может быть nil
+// size - размер файла
+// offset - смещение от начала
+// length - длина, при length <= 0 читается до конца файла
+// Если offset выходит за пределы файла, возвращается ErrInvalidRange
+func newSectionReadCloser(ctx context.Context, r io.ReaderAt, closer io.Closer, size, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 || offset > size {
+		return nil, ErrInvalidRange
+	}
+	if length <= 0 || offset+length > size {
+		length = size - offset
+	}
+	return &sectionReadCloser{io.NewSectionReader(r, offset, length), ctx, closer}, nil
+}
+
+func (r *sectionReadCloser) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.SectionReader.Read(p)
+}
+
+func (r *sectionReadCloser) ReadAt(p []byte, off int64) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.SectionReader.ReadAt(p, off)
+}
+
+func (r *sectionReadCloser) Close() error {
+	if r.closer == nil {
+		return nil
 	}
-	return meta
+	return r.closer.Close()
 }
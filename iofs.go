@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	pathpkg "path"
+	"sort"
+)
+
+// NewFS - возвращает io/fs.FS поверх хранилища для html/template, http.FS, fs.WalkDir и других пакетов, работающих с fs.FS.
+// Результат также реализует fs.StatFS, fs.ReadFileFS и fs.ReadDirFS.
+// Имена проверяются по правилам fs.ValidPath, недопустимые имена отклоняются с fs.ErrInvalid.
+// Open читает файл через FileReader, Stat вызывает Stat хранилища, ReadDir возвращает записи, отсортированные по имени
+// s - хранилище
+func NewFS(s StoreIFace) fs.FS {
+	return storeFS{s: s}
+}
+
+type storeFS struct {
+	s StoreIFace
+}
+
+func (fsys storeFS) Open(name string) (fs.File, error) {
+	info, err := fsys.Stat(name)
+	if err != nil {
+		return nil, fsError("open", name, err)
+	}
+	if info.IsDir() {
+		return &fsDir{fsys: fsys, name: name, info: info}, nil
+	}
+	return &fsFile{
+		fileReadSeeker: fileReadSeeker{ctx: context.Background(), s: fsys.s, path: name, size: info.Size()},
+		info:           info,
+	}, nil
+}
+
+func (fsys storeFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, fsError("stat", name, fs.ErrInvalid)
+	}
+
+	// директории S3 находятся через список родительской директории, см. statEntry
+	info, err := statEntry(context.Background(), fsys.s, name)
+	if err != nil {
+		return nil, fsError("stat", name, err)
+	}
+	// WebDav возвращает в Name отображаемое имя (displayname), а fs.FileInfo - последний элемент пути
+	return fsInfo{FileInfo: info, name: pathpkg.Base(name)}, nil
+}
+
+func (fsys storeFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, fsError("readfile", name, fs.ErrInvalid)
+	}
+	content, err := fsys.s.GetFile(name)
+	if err != nil {
+		return nil, fsError("readfile", name, err)
+	}
+	return content, nil
+}
+
+func (fsys storeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, fsError("readdir", name, fs.ErrInvalid)
+	}
+	infos, err := fsys.s.ReadDir(name)
+	if err != nil {
+		return nil, fsError("readdir", name, err)
+	}
+
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// fsError - возвращает ошибку в виде fs.PathError с именем в fs.FS.
+// Ошибки, уже описывающие это имя, не оборачиваются повторно
+func fsError(op, name string, err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) && pathErr.Path == name {
+		return err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// fsInfo - fs.FileInfo с именем, приведенным к последнему элементу пути
+type fsInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i fsInfo) Name() string {
+	return i.name
+}
+
+// fsFile - fs.File поверх FileReader, поддерживает io.Seeker
+type fsFile struct {
+	fileReadSeeker
+	info fs.FileInfo
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// fsDir - fs.ReadDirFile для директории хранилища
+type fsDir struct {
+	fsys    storeFS
+	name    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) Close() error {
+	return nil
+}
+
+// ReadDir - возвращает записи директории по правилам fs.ReadDirFile
+func (d *fsDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.read = true
+	}
+
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := count
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
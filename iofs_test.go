@@ -0,0 +1,89 @@
+package store_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/vlkalashnikov/go-store"
+)
+
+func TestFSMemory(t *testing.T) {
+	testFS(t, newMemory(t))
+}
+
+func TestFSLocal(t *testing.T) {
+	s, err := store.NewLocal(store.LocalConfig{Root: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testFS(t, s)
+}
+
+// TestFSS3 - директории S3 существуют только как префиксы ключей
+func TestFSS3(t *testing.T) {
+	testFS(t, newS3(t, newFakeS3(t), store.S3Config{}))
+}
+
+// TestFSEmpty - Empty не хранит файлы, Open и Stat возвращают fs.ErrNotExist
+func TestFSEmpty(t *testing.T) {
+	s, err := store.New(store.Config{StoreType: store.EmptyStore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := store.NewFS(s)
+	if _, err := fsys.Open("file.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Open error = %v, want fs.ErrNotExist", err)
+	}
+	if _, err := fs.Stat(fsys, "file.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Stat error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+// testFS - проверяет NewFS через fstest.TestFS и правила fs.ValidPath
+func testFS(t *testing.T, s store.StoreIFace) {
+	for _, dir := range []string{"dir/sub", "empty"} {
+		if err := s.MkdirAll(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{"a.txt": "a", "dir/b.txt": "bb", "dir/sub/c.json": `{"c":3}`}
+	for path, content := range files {
+		if err := s.CreateFile(path, []byte(content), map[string]string{"author": "store"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fsys := store.NewFS(s)
+	if err := fstest.TestFS(fsys, "a.txt", "dir/b.txt", "dir/sub/c.json", "empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := fs.Stat(fsys, "dir/sub"); err != nil || !info.IsDir() || info.Name() != "sub" {
+		t.Fatalf("Stat(dir/sub) = %v, %v", info, err)
+	}
+	sub, err := fs.Sub(fsys, "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(sub, "b.txt", "sub/c.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := fs.ReadFile(fsys, "dir/sub/c.json")
+	if err != nil || string(content) != files["dir/sub/c.json"] {
+		t.Fatalf("ReadFile = %q, %v", content, err)
+	}
+	if _, err := fs.Stat(fsys, "missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Stat(missing) error = %v, want fs.ErrNotExist", err)
+	}
+	for _, name := range []string{"../a.txt", "/a.txt", "dir/", "./a.txt", "dir//b.txt"} {
+		if _, err := fsys.Open(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("Open(%q) error = %v, want fs.ErrInvalid", name, err)
+		}
+		if _, err := fs.ReadFile(fsys, name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("ReadFile(%q) error = %v, want fs.ErrInvalid", name, err)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// JSONOption - параметр записи JSON, см. PutJSON
+type JSONOption func(*jsonOptions)
+
+type jsonOptions struct {
+	compact bool
+}
+
+// JSONCompact - записывать JSON без отступов и переводов строк
+func JSONCompact() JSONOption {
+	return func(o *jsonOptions) {
+		o.compact = true
+	}
+}
+
+// GetJSONCtx - читает файл в формате JSON и возвращает значение типа T.
+// Если файл не существует, возвращается ErrNotExist
+// ctx - контекст
+// s - хранилище
+// path - путь к файлу
+func GetJSONCtx[T any](ctx context.Context, s StoreCtxIFace, path string) (T, error) {
+	var value T
+	content, err := s.GetFileCtx(ctx, path)
+	if err != nil {
+		return value, err
+	}
+	if err := json.Unmarshal(content, &value); err != nil {
+		return value, err
+	}
+	return value, nil
+}
+
+// GetJSON - см. GetJSONCtx
+func GetJSON[T any](s StoreIFace, path string) (T, error) {
+	return GetJSONCtx[T](context.Background(), s, path)
+}
+
+// PutJSONCtx - записывает значение в файл в формате JSON.
+// По умолчанию JSON записывается с отступами, как в CreateJsonFile, см. JSONCompact
+// ctx - контекст
+// s - хранилище
+// path - путь к файлу
+// value - значение
+// meta - метаданные файла
+// opts - параметры записи
+func PutJSONCtx[T any](ctx context.Context, s StoreCtxIFace, path string, value T, meta map[string]string, opts ...JSONOption) error {
+	var o jsonOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var content []byte
+	var err error
+	if o.compact {
+		content, err = json.Marshal(value)
+	} else {
+		content, err = json.MarshalIndent(value, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	return s.CreateFileCtx(ctx, path, content, meta)
+}
+
+// PutJSON - см. PutJSONCtx
+func PutJSON[T any](s StoreIFace, path string, value T, meta map[string]string, opts ...JSONOption) error {
+	return PutJSONCtx(context.Background(), s, path, value, meta, opts...)
+}
+
+// EncodeJSONCtx - записывает значение в файл в формате JSON: вывод json.Encoder передается
+// в StreamToFileWithMetaCtx через io.Pipe, поэтому документ не копируется в []byte для CreateFile.
+// json.Encoder кодирует одно значение целиком, для больших коллекций используйте JSONLinesWriter.
+// По умолчанию JSON записывается с отступами, см. JSONCompact
+// ctx - контекст
+// s - хранилище
+// path - путь к файлу
+// value - значение
+// meta - метаданные файла, при nil прежние метаданные сохраняются
+// opts - параметры записи
+func EncodeJSONCtx(ctx context.Context, s StoreCtxIFace, path string, value interface{}, meta map[string]string, opts ...JSONOption) error {
+	var o jsonOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	pr, pw := io.Pipe()
+	encoded := make(chan error, 1)
+	go func() {
+		enc := json.NewEncoder(pw)
+		if !o.compact {
+			enc.SetIndent("", "  ")
+		}
+		err := enc.Encode(value)
+		pw.CloseWithError(err)
+		encoded <- err
+	}()
+
+	err := s.StreamToFileWithMetaCtx(ctx, pr, path, meta)
+	// если запись прервалась раньше, кодировщик разблокируется ошибкой
+	pr.CloseWithError(io.ErrClosedPipe)
+	if encErr := <-encoded; encErr != nil && encErr != io.ErrClosedPipe {
+		return encErr
+	}
+	return err
+}
+
+// EncodeJSON - см. EncodeJSONCtx
+func EncodeJSON(s StoreIFace, path string, value interface{}, meta map[string]string, opts ...JSONOption) error {
+	return EncodeJSONCtx(context.Background(), s, path, value, meta, opts...)
+}
+
+// DecodeJSONCtx - читает файл в формате JSON потоком: json.Decoder читает из FileReaderCtx
+// без загрузки всего файла в память
+// ctx - контекст
+// s - хранилище
+// path - путь к файлу
+// Если файл не существует, возвращается ErrNotExist
+func DecodeJSONCtx[T any](ctx context.Context, s StoreCtxIFace, path string) (T, error) {
+	var value T
+	stream, err := s.FileReaderCtx(ctx, path, 0, 0)
+	if err != nil {
+		return value, err
+	}
+	defer stream.Close()
+
+	if err := json.NewDecoder(stream).Decode(&value); err != nil {
+		return value, err
+	}
+	return value, nil
+}
+
+// DecodeJSON - см. DecodeJSONCtx
+func DecodeJSON[T any](s StoreIFace, path string) (T, error) {
+	return DecodeJSONCtx[T](context.Background(), s, path)
+}
+
+// JSONLinesWriter - записывает файл в формате JSON Lines (одно значение JSON в строке) потоком.
+// Записи передаются в StreamToFileWithMetaCtx по мере вызова Write, файл появляется после Close
+type JSONLinesWriter struct {
+	pw   *io.PipeWriter
+	enc  *json.Encoder
+	done chan error
+}
+
+// NewJSONLinesWriterCtx - начинает запись файла в формате JSON Lines
+// ctx - контекст, при отмене которого запись прерывается
+// s - хранилище
+// path - путь к файлу
+// meta - метаданные файла, при nil прежние метаданные сохраняются
+// После записи всех значений нужно вызвать Close, иначе файл не будет записан
+func NewJSONLinesWriterCtx(ctx context.Context, s StoreCtxIFace, path string, meta map[string]string) *JSONLinesWriter {
+	pr, pw := io.Pipe()
+	w := &JSONLinesWriter{pw: pw, enc: json.NewEncoder(pw), done: make(chan error, 1)}
+	go func() {
+		err := s.StreamToFileWithMetaCtx(ctx, pr, path, meta)
+		// Write после ошибки записи возвращает ее, а не блокируется
+		if err != nil {
+			pr.CloseWithError(err)
+		} else {
+			pr.CloseWithError(io.ErrClosedPipe)
+		}
+		w.done <- err
+	}()
+	return w
+}
+
+// NewJSONLinesWriter - см. NewJSONLinesWriterCtx
+func NewJSONLinesWriter(s StoreIFace, path string, meta map[string]string) *JSONLinesWriter {
+	return NewJSONLinesWriterCtx(context.Background(), s, path, meta)
+}
+
+// Write - записывает значение отдельной строкой
+func (w *JSONLinesWriter) Write(value interface{}) error {
+	return w.enc.Encode(value)
+}
+
+// Close - завершает запись и возвращает ее результат
+func (w *JSONLinesWriter) Close() error {
+	w.pw.Close()
+	return <-w.done
+}
+
+// Abort - прерывает запись, при атомарной записи прежний файл не изменяется
+func (w *JSONLinesWriter) Abort(err error) error {
+	w.pw.CloseWithError(err)
+	<-w.done
+	return err
+}
+
+// JSONLinesReader - читает файл в формате JSON Lines по одному значению, аналогично bufio.Scanner:
+//
+//	r, err := store.OpenJSONLines[Record](s, "records.jsonl")
+//	...
+//	defer r.Close()
+//	for r.Next() {
+//		record := r.Value()
+//	}
+//	err = r.Err()
+type JSONLinesReader[T any] struct {
+	stream io.ReadCloser
+	dec    *json.Decoder
+	value  T
+	err    error
+}
+
+// OpenJSONLinesCtx - открывает файл в формате JSON Lines для чтения потоком через FileReaderCtx
+// ctx - контекст, при отмене которого чтение прерывается
+// s - хранилище
+// path - путь к файлу
+// Если файл не существует, возвращается ErrNotExist
+func OpenJSONLinesCtx[T any](ctx context.Context, s StoreCtxIFace, path string) (*JSONLinesReader[T], error) {
+	stream, err := s.FileReaderCtx(ctx, path, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesReader[T]{stream: stream, dec: json.NewDecoder(stream)}, nil
+}
+
+// OpenJSONLines - см. OpenJSONLinesCtx
+func OpenJSONLines[T any](s StoreIFace, path string) (*JSONLinesReader[T], error) {
+	return OpenJSONLinesCtx[T](context.Background(), s, path)
+}
+
+// Next - читает следующее значение. Возвращает false в конце файла или при ошибке, см. Err
+func (r *JSONLinesReader[T]) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	var value T
+	if err := r.dec.Decode(&value); err != nil {
+		if err != io.EOF {
+			r.err = err
+		}
+		return false
+	}
+	r.value = value
+	return true
+}
+
+// Value - возвращает значение, прочитанное последним вызовом Next
+func (r *JSONLinesReader[T]) Value() T {
+	return r.value
+}
+
+// Err - возвращает ошибку чтения, конец файла ошибкой не считается
+func (r *JSONLinesReader[T]) Err() error {
+	return r.err
+}
+
+// Close - закрывает файл
+func (r *JSONLinesReader[T]) Close() error {
+	return r.stream.Close()
+}
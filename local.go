@@ -1,52 +1,189 @@
 package store
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 )
 
 type Local struct {
+	root     string
+	realRoot string
+	xattr    bool
+	presign  PresignConfig
 }
 
 func (l *Local) init(cfg LocalConfig) error {
+	l.xattr = cfg.XattrMeta
+	l.presign = cfg.PresignConfig
+	if cfg.Root == "" {
+		return nil
+	}
+
+	root, err := filepath.Abs(cfg.Root)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(root, perm); err != nil {
+		return err
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+
+	l.root, l.realRoot = root, realRoot
 	return nil
 }
 
-// IsExist - проверяет существование файла
+// resolve - возвращает путь к файлу внутри корня хранилища.
+// Пути, выходящие за пределы корня через "..", абсолютные пути и символические ссылки отклоняются
+// path - путь относительно корня хранилища
+func (l *Local) resolve(path string) (string, error) {
+	if l.root == "" {
+		return path, nil
+	}
+
+	rel, err := relPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	full := filepath.Join(l.root, filepath.FromSlash(rel))
+	real, err := evalExisting(full)
+	if err != nil {
+		return "", err
+	}
+	if !withinRoot(l.realRoot, real) {
+		return "", outsideRoot(path)
+	}
+	return full, nil
+}
+
+// IsExistCtx - проверяет существование файла, в том числе пустого
+// ctx - контекст
 // filePath - путь к файлу
+func (l *Local) IsExistCtx(ctx context.Context, filePath string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	filePath, err := l.resolve(filePath)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(filePath)
+	return err == nil
+}
+
+// IsExist - см. IsExistCtx
 func (l *Local) IsExist(filePath string) bool {
-	info, err := os.Stat(filePath)
-	return err == nil && info.Size() > 0
+	return l.IsExistCtx(context.Background(), filePath)
 }
 
-// CreateFile - создает файл
+// CreateFileCtx - атомарно создает файл.
+// Данные и мета-файл записываются во временные файлы в той же директории, сбрасываются на диск
+// и только затем переименовываются, поэтому при сбое или параллельном чтении не видно частично записанного файла
+// ctx - контекст
 // path - путь к файлу
 // file - содержимое файла
 // meta - метаданные файла
-func (l *Local) CreateFile(path string, file []byte, meta map[string]string) error {
-	if meta != nil {
-		if err := os.WriteFile(path+META_PREFIX, meta2Bytes(meta), perm); err != nil {
-			return err
-		}
+func (l *Local) CreateFileCtx(ctx context.Context, path string, file []byte, meta map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	path, err := l.resolve(path)
+	if err != nil {
+		return err
+	}
+	meta, err = normalizeMeta(meta)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := writeTemp(path, file)
+	if err != nil {
+		return err
 	}
-	return os.WriteFile(path, file, perm)
+	return l.commitWithMeta(tmp, path, meta)
 }
 
-// StreamToFile - записывает содержимое потока в файл
+// CreateFile - см. CreateFileCtx
+func (l *Local) CreateFile(path string, file []byte, meta map[string]string) error {
+	return l.CreateFileCtx(context.Background(), path, file, meta)
+}
+
+// StreamToFileCtx - записывает содержимое потока в файл без изменения метаданных, см. StreamToFileWithMetaCtx
+// ctx - контекст
 // stream - поток
 // path - путь к файлу
+func (l *Local) StreamToFileCtx(ctx context.Context, stream io.Reader, path string) error {
+	return l.StreamToFileWithMetaCtx(ctx, stream, path, nil)
+}
+
+// StreamToFile - см. StreamToFileCtx
 func (l *Local) StreamToFile(stream io.Reader, path string) error {
-	file, err := os.Create(path)
+	return l.StreamToFileCtx(context.Background(), stream, path)
+}
+
+// StreamToFileWithMetaCtx - атомарно записывает содержимое потока в файл вместе с метаданными.
+// Поток записывается во временный файл, который переименовывается вместе с мета-файлом только после успешного
+// чтения всего потока, при ошибке или отмене контекста существующий файл и его метаданные не изменяются.
+// Если meta равно nil, прежние метаданные файла сохраняются
+// ctx - контекст, при отмене которого копирование прерывается
+// stream - поток
+// path - путь к файлу
+// meta - метаданные файла
+func (l *Local) StreamToFileWithMetaCtx(ctx context.Context, stream io.Reader, path string, meta map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	path, err := l.resolve(path)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	meta, err = normalizeMeta(meta)
+	if err != nil {
+		return err
+	}
+
+	file, err := createTemp(path)
+	if err != nil {
+		return err
+	}
+	if err := copyStream(ctx, file, stream); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := closeTemp(file); err != nil {
+		return err
+	}
+	return l.commitWithMeta(file.Name(), path, meta)
+}
 
+// StreamToFileWithMeta - см. StreamToFileWithMetaCtx
+func (l *Local) StreamToFileWithMeta(stream io.Reader, path string, meta map[string]string) error {
+	return l.StreamToFileWithMetaCtx(context.Background(), stream, path, meta)
+}
+
+// copyStream - копирует поток в файл, проверяя контекст между блоками
+func copyStream(ctx context.Context, file *os.File, stream io.Reader) error {
 	buf := make([]byte, 1024*1024) // 1MB
 
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		n, err := stream.Read(buf)
 		if err != nil && err != io.EOF {
 			return err
@@ -63,21 +200,158 @@ func (l *Local) StreamToFile(stream io.Reader, path string) error {
 	return nil
 }
 
-// GetFile - возвращает содержимое файла
+// tempFile - временный файл и путь, в который он переименовывается при фиксации записи
+type tempFile struct {
+	tmp  string
+	path string
+}
+
+// createTemp - создает временный файл в директории path.
+// Файл создается с правами perm с учетом umask, как при os.WriteFile
+func createTemp(path string) (*os.File, error) {
+	for i := 0; ; i++ {
+		file, err := os.OpenFile(tempName(path), os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if errors.Is(err, os.ErrExist) && i < 10 {
+			continue
+		}
+		return file, err
+	}
+}
+
+// closeTemp - сбрасывает временный файл на диск и закрывает его, при ошибке файл удаляется
+func closeTemp(file *os.File) error {
+	err := file.Sync()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+// writeTemp - записывает data во временный файл в директории path и возвращает его имя
+func writeTemp(path string, data []byte) (string, error) {
+	file, err := createTemp(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", err
+	}
+	if err := closeTemp(file); err != nil {
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// commitWithMeta - записывает метаданные и переименовывает временный файл данных tmp в path.
+// В режиме XattrMeta метаданные записываются в расширенные атрибуты tmp до переименования и фиксируются вместе с данными.
+// Иначе мета-файл готовится заранее и переименовывается сразу после данных: если переименовать данные не удалось,
+// прежние данные и мета-файл не изменяются. Два переименования не атомарны как пара: при сбое процесса между ними
+// новые данные остаются с прежним мета-файлом. Если meta равно nil, прежние метаданные сохраняются
+func (l *Local) commitWithMeta(tmp, path string, meta map[string]string) error {
+	if l.xattr {
+		err := l.commitWithXattrs(tmp, path, meta)
+		if !xattrNotSupported(err) {
+			return err
+		}
+	}
+
+	if meta == nil {
+		return commitTemps(tempFile{tmp, path})
+	}
+
+	metaTmp, err := writeTemp(path+META_PREFIX, meta2Bytes(meta))
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// данные переименовываются первыми: если это не удалось, оба временных файла удаляются
+	return commitTemps(tempFile{tmp, path}, tempFile{metaTmp, path + META_PREFIX})
+}
+
+// commitWithXattrs - записывает метаданные в расширенные атрибуты tmp и переименовывает его в path.
+// Устаревший мета-файл удаляется
+func (l *Local) commitWithXattrs(tmp, path string, meta map[string]string) error {
+	if meta == nil {
+		current, err := l.readMeta(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			os.Remove(tmp)
+			return err
+		}
+		meta = current
+	}
+
+	if err := setXattrs(tmp, meta); err != nil {
+		if !xattrNotSupported(err) {
+			os.Remove(tmp)
+		}
+		return err
+	}
+	if err := commitTemps(tempFile{tmp, path}); err != nil {
+		return err
+	}
+	return removeSidecar(path)
+}
+
+// commitTemps - переименовывает временные файлы в целевые и сбрасывает на диск директорию.
+// Файлы должны находиться в одной директории. Если переименование не удалось,
+// оставшиеся временные файлы удаляются
+func commitTemps(files ...tempFile) error {
+	for i, f := range files {
+		if err := os.Rename(f.tmp, f.path); err != nil {
+			for _, rest := range files[i:] {
+				os.Remove(rest.tmp)
+			}
+			return err
+		}
+	}
+
+	// ошибка не возвращается: файлы уже на месте, а некоторые платформы не поддерживают fsync директорий
+	if dir, err := os.Open(filepath.Dir(files[0].path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// GetFileCtx - возвращает содержимое файла
+// ctx - контекст
 // path - путь к файлу
-func (l *Local) GetFile(path string) ([]byte, error) {
-	if !l.IsExist(path) {
-		return nil, nil
+func (l *Local) GetFileCtx(ctx context.Context, path string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	path, err := l.resolve(path)
+	if err != nil {
+		return nil, err
 	}
 	return os.ReadFile(path)
 }
 
-// GetFilePartially - возвращает часть содержимого файла
+// GetFile - см. GetFileCtx
+func (l *Local) GetFile(path string) ([]byte, error) {
+	return l.GetFileCtx(context.Background(), path)
+}
+
+// GetFilePartiallyCtx - возвращает часть содержимого файла
+// ctx - контекст
 // path - путь к файлу
 // offset - смещение от начала
-func (l *Local) GetFilePartially(path string, offset, length int64) ([]byte, error) {
-	if !l.IsExist(path) {
-		return nil, nil
+// length - длина, при length <= 0 читается до конца файла
+// Если offset выходит за пределы файла, возвращается ErrInvalidRange
+func (l *Local) GetFilePartiallyCtx(ctx context.Context, path string, offset, length int64) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	path, err := l.resolve(path)
+	if err != nil {
+		return nil, err
 	}
 
 	file, err := os.Open(path)
@@ -86,11 +360,15 @@ func (l *Local) GetFilePartially(path string, offset, length int64) ([]byte, err
 	}
 	defer file.Close()
 
-	if length < 0 {
-		info, _, err := l.Stat(path)
-		if err != nil {
-			return nil, err
-		}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || offset > info.Size() {
+		return nil, ErrInvalidRange
+	}
+
+	if length <= 0 || offset+length > info.Size() {
 		length = info.Size() - offset
 	}
 
@@ -103,49 +381,286 @@ func (l *Local) GetFilePartially(path string, offset, length int64) ([]byte, err
 	return buf, nil
 }
 
-// FileReader - открывает файл на чтение
+// GetFilePartially - см. GetFilePartiallyCtx
+func (l *Local) GetFilePartially(path string, offset, length int64) ([]byte, error) {
+	return l.GetFilePartiallyCtx(context.Background(), path, offset, length)
+}
+
+// FileReaderCtx - открывает часть файла на чтение.
+// Возвращаемый reader также реализует io.ReaderAt и io.Seeker в пределах запрошенной части
+// ctx - контекст, при отмене которого чтение прерывается
 // path - путь к файлу
 // offset - смещение от начала
-// length - длина
-func (l *Local) FileReader(path string, offset, length int64) (io.ReadCloser, error) {
-	if !l.IsExist(path) {
-		return nil, nil
+// length - длина, при length <= 0 читается до конца файла
+// Если offset выходит за пределы файла, возвращается ErrInvalidRange
+func (l *Local) FileReaderCtx(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	path, err := l.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
 	}
 
-	return os.Open(path)
+	r, err := newSectionReadCloser(ctx, file, file, info.Size(), offset, length)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// FileReader - см. FileReaderCtx
+func (l *Local) FileReader(path string, offset, length int64) (io.ReadCloser, error) {
+	return l.FileReaderCtx(context.Background(), path, offset, length)
 }
 
-// RemoveFile - удаляет файл
+// RemoveFileCtx - удаляет файл
+// ctx - контекст
 // path - путь к файлу
-func (l *Local) RemoveFile(path string) error {
+func (l *Local) RemoveFileCtx(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	path, err := l.resolve(path)
+	if err != nil {
+		return err
+	}
 	os.Remove(path + META_PREFIX)
 	return os.Remove(path)
 }
 
-// Stat - возвращает информацию о файле и метаданные
+// RemoveFile - см. RemoveFileCtx
+func (l *Local) RemoveFile(path string) error {
+	return l.RemoveFileCtx(context.Background(), path)
+}
+
+// StatCtx - возвращает информацию о файле и метаданные
+// ctx - контекст
 // path - путь к файлу
-func (l *Local) Stat(path string) (os.FileInfo, map[string]string, error) {
-	info, err := os.Stat(path)
+func (l *Local) StatCtx(ctx context.Context, path string) (os.FileInfo, map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	path, err := l.resolve(path)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	isExist := l.IsExist(path + META_PREFIX)
-	if !isExist {
-		return info, nil, nil
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	meta, err := os.ReadFile(path + META_PREFIX)
+	meta, err := l.readMeta(path)
 	if err != nil {
 		return nil, nil, err
 	}
+	return info, meta, nil
+}
+
+// Stat - см. StatCtx
+func (l *Local) Stat(path string) (os.FileInfo, map[string]string, error) {
+	return l.StatCtx(context.Background(), path)
+}
+
+// GetMetaCtx - возвращает метаданные файла
+// ctx - контекст
+// path - путь к файлу
+// Если файл не существует, возвращается ErrNotExist
+func (l *Local) GetMetaCtx(ctx context.Context, path string) (map[string]string, error) {
+	_, meta, err := l.StatCtx(ctx, path)
+	return meta, err
+}
+
+// GetMeta - см. GetMetaCtx
+func (l *Local) GetMeta(path string) (map[string]string, error) {
+	return l.GetMetaCtx(context.Background(), path)
+}
+
+// UpdateMetaCtx - изменяет метаданные файла без перезаписи его содержимого.
+// Перезаписывается только мета-файл, атомарно через временный файл
+// ctx - контекст
+// path - путь к файлу
+// set - добавляемые и изменяемые ключи
+// unset - удаляемые ключи, удаляются до добавления set
+// Если файл не существует, возвращается ErrNotExist
+func (l *Local) UpdateMetaCtx(ctx context.Context, path string, set map[string]string, unset []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	path, err := l.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return &os.PathError{Op: "updatemeta", Path: path, Err: syscall.EISDIR}
+	}
+
+	current, err := l.readMeta(path)
+	if err != nil {
+		return err
+	}
+	meta, err := mergeMeta(current, set, unset)
+	if err != nil {
+		return err
+	}
+
+	if l.xattr {
+		err := setXattrs(path, meta)
+		if err == nil {
+			return removeSidecar(path)
+		}
+		if !xattrNotSupported(err) {
+			return err
+		}
+	}
 
-	return info, bytes2Meta(meta), nil
+	if len(meta) == 0 {
+		return removeSidecar(path)
+	}
+	tmp, err := writeTemp(path+META_PREFIX, meta2Bytes(meta))
+	if err != nil {
+		return err
+	}
+	return commitTemps(tempFile{tmp, path + META_PREFIX})
 }
 
-// ClearDir - очищает директорию
+// UpdateMeta - см. UpdateMetaCtx
+func (l *Local) UpdateMeta(path string, set map[string]string, unset []string) error {
+	return l.UpdateMetaCtx(context.Background(), path, set, unset)
+}
+
+// MigrateMetaToXattrCtx - переносит метаданные из мета-файлов в расширенные атрибуты файлов.
+// Обходит директорию рекурсивно, после переноса мета-файл удаляется. Мета-файлы без файла данных пропускаются.
+// Если файловая система не поддерживает расширенные атрибуты, возвращается ошибка.
+// После переноса метаданные видны только хранилищу с XattrMeta
+// ctx - контекст, при отмене которого перенос прерывается
 // path - путь к директории
-func (l *Local) ClearDir(path string) error {
+func (l *Local) MigrateMetaToXattrCtx(ctx context.Context, path string) error {
+	root, err := l.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() || !isMetaFile(p) {
+			return nil
+		}
+
+		data := strings.TrimSuffix(p, META_PREFIX)
+		if _, err := os.Stat(data); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		meta, err := readSidecar(data)
+		if err != nil {
+			return err
+		}
+		if err := setXattrs(data, meta); err != nil {
+			return err
+		}
+		return os.Remove(p)
+	})
+}
+
+// MigrateMetaToXattr - см. MigrateMetaToXattrCtx
+func (l *Local) MigrateMetaToXattr(path string) error {
+	return l.MigrateMetaToXattrCtx(context.Background(), path)
+}
+
+// MigrateMetaToXattrCtx - переносит метаданные хранилища s из мета-файлов в расширенные атрибуты,
+// см. (*Local).MigrateMetaToXattrCtx. Позволяет не приводить StoreIFace из New к *Local.
+// Для других хранилищ возвращается ошибка
+// ctx - контекст
+// s - хранилище Local
+// path - путь к директории
+func MigrateMetaToXattrCtx(ctx context.Context, s StoreIFace, path string) error {
+	l, ok := s.(*Local)
+	if !ok {
+		return fmt.Errorf("%w: %T is not a local store", errXattrNotSupported, s)
+	}
+	return l.MigrateMetaToXattrCtx(ctx, path)
+}
+
+// MigrateMetaToXattr - см. MigrateMetaToXattrCtx
+func MigrateMetaToXattr(s StoreIFace, path string) error {
+	return MigrateMetaToXattrCtx(context.Background(), s, path)
+}
+
+// readMeta - возвращает метаданные файла path.
+// В режиме XattrMeta метаданные читаются из расширенных атрибутов, а если их нет - из мета-файла
+func (l *Local) readMeta(path string) (map[string]string, error) {
+	if l.xattr {
+		meta, err := getXattrs(path)
+		if err != nil && !xattrNotSupported(err) {
+			return nil, err
+		}
+		if len(meta) > 0 {
+			return meta, nil
+		}
+	}
+	return readSidecar(path)
+}
+
+// removeSidecar - удаляет мета-файл файла path, если он есть
+func removeSidecar(path string) error {
+	if err := os.Remove(path + META_PREFIX); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// readSidecar - читает мета-файл файла path, если мета-файла нет, возвращается nil
+func readSidecar(path string) (map[string]string, error) {
+	meta, err := os.ReadFile(path + META_PREFIX)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes2Meta(meta)
+}
+
+// ClearDirCtx - очищает директорию
+// ctx - контекст, при отмене которого очистка прерывается
+// path - путь к директории, корень хранилища - "."
+// Для пустого пути возвращается ErrNotExist
+func (l *Local) ClearDirCtx(ctx context.Context, path string) error {
+	if path == "" {
+		return emptyPathError("open")
+	}
+	path, err := l.resolve(path)
+	if err != nil {
+		return err
+	}
+
 	d, err := os.Open(path)
 	if err != nil {
 		return err
@@ -156,6 +671,9 @@ func (l *Local) ClearDir(path string) error {
 		return err
 	}
 	for _, name := range names {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
 		err = os.RemoveAll(filepath.Join(path, name))
 		if err != nil {
 			return err
@@ -164,35 +682,324 @@ func (l *Local) ClearDir(path string) error {
 	return nil
 }
 
-// MkdirAll - создает директорию
+// ClearDir - см. ClearDirCtx
+func (l *Local) ClearDir(path string) error {
+	return l.ClearDirCtx(context.Background(), path)
+}
+
+// MkdirAllCtx - создает директорию
+// ctx - контекст
 // path - путь к директории
-func (l *Local) MkdirAll(path string) error {
+func (l *Local) MkdirAllCtx(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	path, err := l.resolve(path)
+	if err != nil {
+		return err
+	}
 	return os.MkdirAll(path, perm)
 }
 
-// CreateJsonFile - создает файл с данными в формате JSON
+// MkdirAll - см. MkdirAllCtx
+func (l *Local) MkdirAll(path string) error {
+	return l.MkdirAllCtx(context.Background(), path)
+}
+
+// ReadDirCtx - возвращает содержимое директории без мета-файлов и временных файлов
+// ctx - контекст
+// path - путь к директории
+func (l *Local) ReadDirCtx(ctx context.Context, path string) ([]os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	path, err := l.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names[entry.Name()] = true
+		}
+	}
+
+	files := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && isServiceFile(entry.Name(), func(name string) bool { return names[name] }) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+// ReadDir - см. ReadDirCtx
+func (l *Local) ReadDir(path string) ([]os.FileInfo, error) {
+	return l.ReadDirCtx(context.Background(), path)
+}
+
+// WalkCtx - рекурсивно обходит директорию, пропуская мета-файлы и временные файлы
+// ctx - контекст, при отмене которого обход прерывается
+// path - путь к директории
+// fn - функция, вызываемая для каждого файла и директории
+func (l *Local) WalkCtx(ctx context.Context, path string, fn filepath.WalkFunc) error {
+	root, err := l.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	fn = walkFuncCtx(ctx, fn)
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && isServiceFile(p, isRegularFile) {
+			return nil
+		}
+		if root != path {
+			// в fn передаются пути относительно корня хранилища
+			rel, relErr := filepath.Rel(root, p)
+			if relErr != nil {
+				return relErr
+			}
+			p = filepath.Join(path, rel)
+		}
+		return fn(p, info, err)
+	})
+}
+
+// Walk - см. WalkCtx
+func (l *Local) Walk(path string, fn filepath.WalkFunc) error {
+	return l.WalkCtx(context.Background(), path, fn)
+}
+
+// isRegularFile - проверяет, что по пути path находится обычный файл
+func isRegularFile(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// CopyCtx - копирует файл вместе с метаданными.
+// Содержимое копируется во временный файл, который переименовывается вместе с метаданными, как в CreateFileCtx,
+// поэтому при ошибке или отмене контекста существующий dst и его метаданные не изменяются
+// ctx - контекст, при отмене которого копирование прерывается
+// src - путь к исходному файлу
+// dst - путь к новому файлу
+func (l *Local) CopyCtx(ctx context.Context, src, dst string) error {
+	src, dst, err := l.resolvePair(src, dst)
+	if err != nil {
+		return err
+	}
+	return l.copyFile(ctx, src, dst)
+}
+
+// Copy - см. CopyCtx
+func (l *Local) Copy(src, dst string) error {
+	return l.CopyCtx(context.Background(), src, dst)
+}
+
+// MoveCtx - перемещает (переименовывает) файл вместе с метаданными.
+// Если src и dst находятся на разных устройствах, файл копируется, как в CopyCtx, а исходный удаляется
+// ctx - контекст
+// src - путь к исходному файлу
+// dst - путь к новому файлу
+func (l *Local) MoveCtx(ctx context.Context, src, dst string) error {
+	src, dst, err := l.resolvePair(src, dst)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err = os.Rename(src, dst)
+	if errors.Is(err, syscall.EXDEV) {
+		if err := l.copyFile(ctx, src, dst); err != nil {
+			return err
+		}
+		if err := os.Remove(src); err != nil {
+			return err
+		}
+		return removeSidecar(src)
+	}
+	if err != nil {
+		return err
+	}
+	// мета-файл лежит в той же директории, что и данные, поэтому переименовывается на том же устройстве
+	return l.syncMeta(src, dst, os.Rename)
+}
+
+// Move - см. MoveCtx
+func (l *Local) Move(src, dst string) error {
+	return l.MoveCtx(context.Background(), src, dst)
+}
+
+// resolvePair - см. resolve
+func (l *Local) resolvePair(src, dst string) (string, string, error) {
+	src, err := l.resolve(src)
+	if err != nil {
+		return "", "", err
+	}
+	dst, err = l.resolve(dst)
+	if err != nil {
+		return "", "", err
+	}
+	return src, dst, nil
+}
+
+// syncMeta - переносит мета-файл src в dst с помощью fn.
+// Если у src нет мета-файла, устаревший мета-файл dst удаляется
+func (l *Local) syncMeta(src, dst string, fn func(src, dst string) error) error {
+	if _, err := os.Stat(src + META_PREFIX); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = os.Remove(dst + META_PREFIX)
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+		}
+		return err
+	}
+	return fn(src+META_PREFIX, dst+META_PREFIX)
+}
+
+// copyFile - копирует файл src вместе с метаданными в dst через временный файл, см. commitWithMeta.
+// Если у src нет метаданных, устаревший мета-файл dst удаляется
+func (l *Local) copyFile(ctx context.Context, src, dst string) error {
+	tmp, err := copyTemp(ctx, src, dst)
+	if err != nil {
+		return err
+	}
+	meta, err := l.readMeta(src)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if meta == nil {
+		if err := commitTemps(tempFile{tmp, dst}); err != nil {
+			return err
+		}
+		return removeSidecar(dst)
+	}
+	return l.commitWithMeta(tmp, dst, meta)
+}
+
+// copyTemp - копирует содержимое файла src во временный файл в директории dst с сохранением прав доступа
+// и возвращает его имя. При ошибке или отмене контекста временный файл удаляется
+func copyTemp(ctx context.Context, src, dst string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	out, err := createTemp(dst)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(out, &ctxReader{ctx, in})
+	if err == nil {
+		err = out.Chmod(info.Mode().Perm())
+	}
+	if err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", err
+	}
+	if err := closeTemp(out); err != nil {
+		return "", err
+	}
+
+	// расширенные атрибуты с метаданными (XattrMeta) копируются вместе с файлом
+	meta, err := getXattrs(src)
+	if err == nil {
+		err = setXattrs(out.Name(), meta)
+	}
+	if err != nil && !xattrNotSupported(err) {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// CreateJsonFileCtx - создает файл с данными в формате JSON
+// ctx - контекст
 // path - путь к файлу
 // data - данные
 // meta - метаданные
-func (l *Local) CreateJsonFile(path string, data interface{}, meta map[string]string) error {
+func (l *Local) CreateJsonFileCtx(ctx context.Context, path string, data interface{}, meta map[string]string) error {
 	content, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return l.CreateFile(path, content, meta)
+	return l.CreateFileCtx(ctx, path, content, meta)
+}
+
+// CreateJsonFile - см. CreateJsonFileCtx
+func (l *Local) CreateJsonFile(path string, data interface{}, meta map[string]string) error {
+	return l.CreateJsonFileCtx(context.Background(), path, data, meta)
 }
 
-// GetJsonFile - возвращает содержимое файла в формате JSON
+// GetJsonFileCtx - возвращает содержимое файла в формате JSON
+// ctx - контекст
 // path - путь к файлу
 // file - переменная для десериализации
-func (l *Local) GetJsonFile(path string, file interface{}) error {
-	content, err := l.GetFile(path)
+// Если файл не существует, возвращается ErrNotExist. Если файл пуст, file не изменяется и ошибка не возвращается
+func (l *Local) GetJsonFileCtx(ctx context.Context, path string, file interface{}) error {
+	content, err := l.GetFileCtx(ctx, path)
 	if err != nil {
 		return err
 	}
-	if content == nil {
+	if len(content) == 0 {
 		return nil
 	}
 	return json.Unmarshal(content, file)
 }
+
+// GetJsonFile - см. GetJsonFileCtx
+func (l *Local) GetJsonFile(path string, file interface{}) error {
+	return l.GetJsonFileCtx(context.Background(), path, file)
+}
+
+// PresignGet - возвращает ссылку для скачивания файла, подписанную PresignSecret, см. NewPresignHandler
+// path - путь к файлу
+// ttl - срок действия ссылки
+func (l *Local) PresignGet(path string, ttl time.Duration) (string, error) {
+	if _, err := l.resolve(path); err != nil {
+		return "", err
+	}
+	return presign(l.presign, http.MethodGet, path, ttl, nil)
+}
+
+// PresignPut - возвращает ссылку для загрузки файла, подписанную PresignSecret, см. NewPresignHandler.
+// Метаданные входят в подпись ссылки, поэтому дополнительные заголовки не нужны
+// path - путь к файлу
+// ttl - срок действия ссылки
+// meta - метаданные файла, при nil прежние метаданные сохраняются
+func (l *Local) PresignPut(path string, ttl time.Duration, meta map[string]string) (string, http.Header, error) {
+	if _, err := l.resolve(path); err != nil {
+		return "", nil, err
+	}
+	url, err := presign(l.presign, http.MethodPut, path, ttl, meta)
+	return url, nil, err
+}
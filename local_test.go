@@ -0,0 +1,296 @@
+package store_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/vlkalashnikov/go-store"
+	"github.com/vlkalashnikov/go-store/storetest"
+)
+
+func TestLocal(t *testing.T) {
+	storetest.RunConformance(t, func(t *testing.T) store.StoreIFace {
+		s, err := store.NewLocal(store.LocalConfig{Root: t.TempDir()})
+		if err != nil {
+			t.Fatalf("NewLocal: %v", err)
+		}
+		return s
+	})
+}
+
+// TestLocalWithoutRoot - без Root пути используются как есть, поэтому тест работает с абсолютными путями
+// во временной директории и не меняет рабочую директорию процесса
+func TestLocalWithoutRoot(t *testing.T) {
+	dir := t.TempDir()
+	s, err := store.NewLocal(store.LocalConfig{})
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+
+	if err := s.MkdirAll(dir + "/sub"); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if !s.IsExist(dir + "/sub") {
+		t.Fatal("IsExist(sub) = false, want true")
+	}
+	if err := s.CreateFile(dir+"/sub/file.txt", []byte("data"), map[string]string{"author": "store"}); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(dir, "sub", "file.txt")); err != nil || string(content) != "data" {
+		t.Fatalf("file on disk = %q, %v", content, err)
+	}
+	if meta, err := s.GetMeta(dir + "/sub/file.txt"); err != nil || meta["author"] != "store" {
+		t.Fatalf("GetMeta = %v, %v", meta, err)
+	}
+	if err := s.StreamToFile(strings.NewReader("stream"), dir+"/sub/stream.txt"); err != nil {
+		t.Fatalf("StreamToFile: %v", err)
+	}
+	if err := s.Copy(dir+"/sub/file.txt", dir+"/copy.txt"); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	if err := s.Move(dir+"/copy.txt", dir+"/moved.txt"); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	if meta, err := s.GetMeta(dir + "/moved.txt"); err != nil || meta["author"] != "store" {
+		t.Fatalf("GetMeta(moved) = %v, %v", meta, err)
+	}
+
+	infos, err := s.ReadDir(dir + "/sub")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var got []string
+	for _, info := range infos {
+		got = append(got, info.Name())
+	}
+	sort.Strings(got)
+	if want := []string{"file.txt", "stream.txt"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ReadDir = %v, want %v", got, want)
+	}
+
+	if err := s.ClearDir(dir + "/sub"); err != nil {
+		t.Fatalf("ClearDir: %v", err)
+	}
+	if s.IsExist(dir + "/sub/file.txt") {
+		t.Fatal("ClearDir did not remove file")
+	}
+	if err := s.RemoveFile(dir + "/moved.txt"); err != nil {
+		t.Fatalf("RemoveFile: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "moved.txt"+store.META_PREFIX)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("sidecar left after RemoveFile: %v", err)
+	}
+}
+
+func TestLocalRootEscape(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	if err := os.MkdirAll(outside, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := store.NewLocal(store.LocalConfig{Root: root})
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "new.txt"), filepath.Join(root, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"../outside/secret.txt", "dir/../../outside/secret.txt", filepath.Join(outside, "secret.txt"), "link/secret.txt"} {
+		if _, err := s.GetFile(p); !errors.Is(err, store.ErrOutsideRoot) {
+			t.Errorf("GetFile(%q) error = %v, want ErrOutsideRoot", p, err)
+		}
+	}
+	for _, p := range []string{"link/new.txt", "dangling"} {
+		if err := s.CreateFile(p, []byte("data"), nil); !errors.Is(err, store.ErrOutsideRoot) {
+			t.Errorf("CreateFile(%q) error = %v, want ErrOutsideRoot", p, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file was created outside of root: %v", err)
+	}
+
+	// ссылки внутри корня разрешены
+	if err := s.MkdirAll("dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateFile("dir/file.txt", []byte("data"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "dir"), filepath.Join(root, "inner")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetFile("inner/file.txt"); err != nil {
+		t.Errorf("GetFile through symlink inside root: %v", err)
+	}
+}
+
+func TestLocalFileReaderRandomAccess(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := store.NewLocal(store.LocalConfig{})
+	if err := s.CreateFile(dir+"/file.txt", []byte("0123456789"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := s.FileReader(dir+"/file.txt", 2, 6)
+	if err != nil {
+		t.Fatalf("FileReader: %v", err)
+	}
+	defer r.Close()
+
+	if _, ok := r.(io.ReaderAt); !ok {
+		t.Fatal("FileReader result does not implement io.ReaderAt")
+	}
+	if _, ok := r.(io.Seeker); !ok {
+		t.Fatal("FileReader result does not implement io.Seeker")
+	}
+}
+
+// TestLocalAtomicStream - проверяет, что прерванная запись потока не изменяет файл и не оставляет временных файлов
+func TestLocalAtomicStream(t *testing.T) {
+	root := t.TempDir()
+	s, err := store.NewLocal(store.LocalConfig{Root: root})
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	if err := s.CreateFile("file.txt", []byte("old"), map[string]string{"version": "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := io.MultiReader(strings.NewReader("new content"), iotest.ErrReader(errors.New("broken stream")))
+	if err := s.StreamToFileWithMeta(stream, "file.txt", map[string]string{"version": "2"}); err == nil {
+		t.Fatal("StreamToFileWithMeta with broken stream succeeded")
+	}
+
+	content, err := s.GetFile("file.txt")
+	if err != nil || string(content) != "old" {
+		t.Fatalf("GetFile = %q, %v; want old content", content, err)
+	}
+	if _, meta, err := s.Stat("file.txt"); err != nil || meta["version"] != "1" {
+		t.Fatalf("Stat meta = %v, %v; want old meta", meta, err)
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if name := entry.Name(); name != "file.txt" && name != "file.txt"+store.META_PREFIX {
+			t.Errorf("unexpected file %q left in directory", name)
+		}
+	}
+}
+
+// TestLocalLegacyMeta - проверяет чтение мета-файлов старого формата "key=value"
+func TestLocalLegacyMeta(t *testing.T) {
+	root := t.TempDir()
+	s, err := store.NewLocal(store.LocalConfig{Root: root})
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	if err := s.CreateFile("file.txt", []byte("data"), nil); err != nil {
+		t.Fatal(err)
+	}
+	legacy := "Author=store\nurl=https://example.com/?a=1&b=2\n"
+	if err := os.WriteFile(filepath.Join(root, "file.txt"+store.META_PREFIX), []byte(legacy), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	_, meta, err := s.Stat("file.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	want := map[string]string{"author": "store", "url": "https://example.com/?a=1&b=2"}
+	if !reflect.DeepEqual(meta, want) {
+		t.Fatalf("Stat meta = %v, want %v", meta, want)
+	}
+}
+
+// TestLocalMetaCommitFailure - проверяет, что при ошибке переименования данных мета-файл не меняется
+func TestLocalMetaCommitFailure(t *testing.T) {
+	root := t.TempDir()
+	s, err := store.NewLocal(store.LocalConfig{Root: root})
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	// непустая директория на месте файла: данные не переименовываются, мета-файл не должен измениться
+	for _, name := range []string{"old", "new"} {
+		if err := os.MkdirAll(filepath.Join(root, name, "child"), 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sidecar := filepath.Join(root, "old"+store.META_PREFIX)
+	legacy := []byte("author=old\n")
+	if err := os.WriteFile(sidecar, legacy, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"old", "new"} {
+		if err := s.CreateFile(name, []byte("data"), map[string]string{"author": "new"}); err == nil {
+			t.Fatalf("CreateFile(%q) over directory succeeded", name)
+		}
+		stream := strings.NewReader("data")
+		if err := s.StreamToFileWithMeta(stream, name, map[string]string{"author": "new"}); err == nil {
+			t.Fatalf("StreamToFileWithMeta(%q) over directory succeeded", name)
+		}
+	}
+
+	if content, err := os.ReadFile(sidecar); err != nil || !bytes.Equal(content, legacy) {
+		t.Fatalf("old sidecar = %q, %v; want %q", content, err, legacy)
+	}
+	if _, err := os.Stat(filepath.Join(root, "new"+store.META_PREFIX)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("new sidecar left after failed commit: %v", err)
+	}
+}
+
+// TestLocalCopyFailure - при ошибке чтения источника существующий файл и его метаданные не изменяются,
+// временные файлы не остаются
+func TestLocalCopyFailure(t *testing.T) {
+	root := t.TempDir()
+	s, err := store.NewLocal(store.LocalConfig{Root: root})
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	if err := s.CreateFile("dst.txt", []byte("old"), map[string]string{"author": "old"}); err != nil {
+		t.Fatal(err)
+	}
+	// директория открывается, но не читается
+	if err := s.MkdirAll("dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Copy("dir", "dst.txt"); err == nil {
+		t.Fatal("Copy from directory succeeded")
+	}
+	if content, err := s.GetFile("dst.txt"); err != nil || string(content) != "old" {
+		t.Fatalf("dst after failed Copy = %q, %v", content, err)
+	}
+	if meta, err := s.GetMeta("dst.txt"); err != nil || meta["author"] != "old" {
+		t.Fatalf("dst meta after failed Copy = %v, %v", meta, err)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Fatalf("temp file %q left after failed Copy", entry.Name())
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/vlkalashnikov/go-store"
+	"github.com/vlkalashnikov/go-store/storetest"
+)
+
+// xattrRoot - возвращает временную директорию, если ее файловая система поддерживает user.* атрибуты
+func xattrRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	probe := filepath.Join(root, "probe")
+	if err := os.WriteFile(probe, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Setxattr(probe, "user.probe", []byte("1"), 0); err != nil {
+		t.Skipf("extended attributes are not supported: %v", err)
+	}
+	os.Remove(probe)
+	return root
+}
+
+func TestLocalXattr(t *testing.T) {
+	storetest.RunConformance(t, func(t *testing.T) store.StoreIFace {
+		s, err := store.NewLocal(store.LocalConfig{Root: xattrRoot(t), XattrMeta: true})
+		if err != nil {
+			t.Fatalf("NewLocal: %v", err)
+		}
+		return s
+	})
+}
+
+func TestLocalXattrNoSidecar(t *testing.T) {
+	root := xattrRoot(t)
+	s, err := store.NewLocal(store.LocalConfig{Root: root, XattrMeta: true})
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	if err := s.CreateFile("file.txt", []byte("data"), map[string]string{"author": "store"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "file.txt"+store.META_PREFIX)); !os.IsNotExist(err) {
+		t.Fatalf("sidecar exists in xattr mode: %v", err)
+	}
+	buf := make([]byte, 64)
+	n, err := syscall.Getxattr(filepath.Join(root, "file.txt"), "user.go-store.author", buf)
+	if err != nil || string(buf[:n]) != "store" {
+		t.Fatalf("user.go-store.author = %q, %v; want \"store\"", buf[:n], err)
+	}
+}
+
+// TestLocalXattrForeign - проверяет, что атрибуты других программ не попадают в метаданные и не удаляются
+func TestLocalXattrForeign(t *testing.T) {
+	root := xattrRoot(t)
+	s, err := store.NewLocal(store.LocalConfig{Root: root, XattrMeta: true})
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	if err := s.CreateFile("file.txt", []byte("data"), map[string]string{"author": "store"}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(root, "file.txt")
+	if err := syscall.Setxattr(path, "user.xdg.origin.url", []byte("https://example.com"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if meta, err := s.GetMeta("file.txt"); err != nil || !reflect.DeepEqual(meta, map[string]string{"author": "store"}) {
+		t.Fatalf("GetMeta = %v, %v; want only author", meta, err)
+	}
+	if err := s.UpdateMeta("file.txt", map[string]string{"version": "1"}, []string{"author"}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	n, err := syscall.Getxattr(path, "user.xdg.origin.url", buf)
+	if err != nil || string(buf[:n]) != "https://example.com" {
+		t.Fatalf("user.xdg.origin.url = %q, %v; want it kept", buf[:n], err)
+	}
+}
+
+func TestLocalMigrateMetaToXattr(t *testing.T) {
+	root := xattrRoot(t)
+	sidecars, err := store.NewLocal(store.LocalConfig{Root: root})
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	meta := map[string]string{"author": "store", "url": "https://example.com/?a=1"}
+	if err := sidecars.MkdirAll("dir"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"a.txt", "dir/b.txt"} {
+		if err := sidecars.CreateFile(p, []byte("data"), meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// мета-файл без файла данных остается на месте
+	orphan := filepath.Join(root, "orphan.txt"+store.META_PREFIX)
+	if err := os.WriteFile(orphan, []byte("author=store\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := store.NewLocal(store.LocalConfig{Root: root, XattrMeta: true})
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	if err := store.MigrateMetaToXattr(s, ""); err != nil {
+		t.Fatalf("MigrateMetaToXattr: %v", err)
+	}
+
+	for _, p := range []string{"a.txt", "dir/b.txt"} {
+		if _, err := os.Stat(filepath.Join(root, p+store.META_PREFIX)); !os.IsNotExist(err) {
+			t.Errorf("sidecar of %q was not removed: %v", p, err)
+		}
+		got, err := s.GetMeta(p)
+		if err != nil || !reflect.DeepEqual(got, meta) {
+			t.Errorf("GetMeta(%q) = %v, %v; want %v", p, got, err, meta)
+		}
+	}
+	if _, err := os.Stat(orphan); err != nil {
+		t.Errorf("orphan sidecar was removed: %v", err)
+	}
+}
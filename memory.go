@@ -0,0 +1,679 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Memory - хранилище в памяти.
+// Поведение IsExist, GetFilePartially, FileReader, ClearDir и Stat совпадает с Local,
+// поэтому Memory можно использовать в тестах вместо локальной директории, S3 или WebDav
+type Memory struct {
+	mu    sync.RWMutex
+	files map[string]*memFile
+}
+
+// memFile - файл или директория хранилища в памяти.
+// Содержимое файла не изменяется после записи, а заменяется целиком,
+// поэтому data можно отдавать читателям без копирования
+type memFile struct {
+	data     []byte
+	meta     map[string]string
+	modified time.Time
+	isdir    bool
+}
+
+func (m *Memory) init(cfg MemoryConfig) error {
+	m.files = make(map[string]*memFile)
+	return nil
+}
+
+// IsExistCtx - проверяет существование файла, в том числе пустого
+// ctx - контекст
+// filePath - путь к файлу
+func (m *Memory) IsExistCtx(ctx context.Context, filePath string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	name := cleanPath(filePath)
+	if isRoot(name) {
+		// корень существует всегда, как "." в Local
+		return true
+	}
+	_, ok := m.files[name]
+	return ok
+}
+
+// IsExist - см. IsExistCtx
+func (m *Memory) IsExist(filePath string) bool {
+	return m.IsExistCtx(context.Background(), filePath)
+}
+
+// CreateFileCtx - создает файл
+// ctx - контекст
+// path - путь к файлу
+// file - содержимое файла
+// meta - метаданные файла, при meta == nil метаданные не изменяются
+func (m *Memory) CreateFileCtx(ctx context.Context, path string, file []byte, meta map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	meta, err := normalizeMeta(meta)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.write("open", path, bytes.Clone(file), meta)
+}
+
+// CreateFile - см. CreateFileCtx
+func (m *Memory) CreateFile(path string, file []byte, meta map[string]string) error {
+	return m.CreateFileCtx(context.Background(), path, file, meta)
+}
+
+// StreamToFileCtx - записывает содержимое потока в файл без изменения метаданных, см. StreamToFileWithMetaCtx
+// ctx - контекст
+// stream - поток
+// path - путь к файлу
+func (m *Memory) StreamToFileCtx(ctx context.Context, stream io.Reader, path string) error {
+	return m.StreamToFileWithMetaCtx(ctx, stream, path, nil)
+}
+
+// StreamToFile - см. StreamToFileCtx
+func (m *Memory) StreamToFile(stream io.Reader, path string) error {
+	return m.StreamToFileCtx(context.Background(), stream, path)
+}
+
+// StreamToFileWithMetaCtx - записывает содержимое потока в файл вместе с метаданными.
+// Если meta равно nil, прежние метаданные файла сохраняются
+// ctx - контекст, при отмене которого чтение потока прерывается
+// stream - поток
+// path - путь к файлу
+// meta - метаданные файла
+func (m *Memory) StreamToFileWithMetaCtx(ctx context.Context, stream io.Reader, path string, meta map[string]string) error {
+	meta, err := normalizeMeta(meta)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(&ctxReader{ctx, stream})
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.write("open", path, data, meta)
+}
+
+// StreamToFileWithMeta - см. StreamToFileWithMetaCtx
+func (m *Memory) StreamToFileWithMeta(stream io.Reader, path string, meta map[string]string) error {
+	return m.StreamToFileWithMetaCtx(context.Background(), stream, path, meta)
+}
+
+// GetFileCtx - возвращает содержимое файла
+// ctx - контекст
+// path - путь к файлу
+func (m *Memory) GetFileCtx(ctx context.Context, path string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	f, err := m.file("open", path)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(f.data), nil
+}
+
+// GetFile - см. GetFileCtx
+func (m *Memory) GetFile(path string) ([]byte, error) {
+	return m.GetFileCtx(context.Background(), path)
+}
+
+// GetFilePartiallyCtx - возвращает часть содержимого файла
+// ctx - контекст
+// path - путь к файлу
+// offset - смещение от начала
+// length - длина, при length <= 0 читается до конца файла
+// Если offset выходит за пределы файла, возвращается ErrInvalidRange
+func (m *Memory) GetFilePartiallyCtx(ctx context.Context, path string, offset, length int64) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	f, err := m.file("open", path)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(len(f.data))
+	if offset < 0 || offset > size {
+		return nil, ErrInvalidRange
+	}
+	if length <= 0 || offset+length > size {
+		length = size - offset
+	}
+
+	return bytes.Clone(f.data[offset : offset+length]), nil
+}
+
+// GetFilePartially - см. GetFilePartiallyCtx
+func (m *Memory) GetFilePartially(path string, offset, length int64) ([]byte, error) {
+	return m.GetFilePartiallyCtx(context.Background(), path, offset, length)
+}
+
+// FileReaderCtx - возвращает io.ReadCloser для чтения части файла.
+// Возвращаемый reader также реализует io.ReaderAt и io.Seeker в пределах запрошенной части
+// ctx - контекст, при отмене которого чтение прерывается
+// path - путь к файлу
+// offset - смещение от начала
+// length - длина, при length <= 0 читается до конца файла
+// Если offset выходит за пределы файла, возвращается ErrInvalidRange
+func (m *Memory) FileReaderCtx(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	f, err := m.file("open", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSectionReadCloser(ctx, bytes.NewReader(f.data), nil, int64(len(f.data)), offset, length)
+}
+
+// FileReader - см. FileReaderCtx
+func (m *Memory) FileReader(path string, offset, length int64) (io.ReadCloser, error) {
+	return m.FileReaderCtx(context.Background(), path, offset, length)
+}
+
+// RemoveFileCtx - удаляет файл или пустую директорию
+// ctx - контекст
+// path - путь к файлу
+func (m *Memory) RemoveFileCtx(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := cleanPath(path)
+	f, ok := m.files[name]
+	if !ok {
+		return memError("remove", path, fs.ErrNotExist)
+	}
+	if f.isdir && len(m.children(name)) > 0 {
+		return memError("remove", path, syscall.ENOTEMPTY)
+	}
+
+	delete(m.files, name)
+	return nil
+}
+
+// RemoveFile - см. RemoveFileCtx
+func (m *Memory) RemoveFile(path string) error {
+	return m.RemoveFileCtx(context.Background(), path)
+}
+
+// StatCtx - возвращает информацию о файле и метаданные
+// ctx - контекст
+// path - путь к файлу
+func (m *Memory) StatCtx(ctx context.Context, path string) (os.FileInfo, map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	name := cleanPath(path)
+	if isRoot(name) {
+		return &File{name: name, isdir: true}, nil, nil
+	}
+
+	f, ok := m.files[name]
+	if !ok {
+		return nil, nil, memError("stat", path, fs.ErrNotExist)
+	}
+
+	return f.info(name), copyMeta(f.meta), nil
+}
+
+// Stat - см. StatCtx
+func (m *Memory) Stat(path string) (os.FileInfo, map[string]string, error) {
+	return m.StatCtx(context.Background(), path)
+}
+
+// GetMetaCtx - возвращает метаданные файла
+// ctx - контекст
+// path - путь к файлу
+// Если файл не существует, возвращается ErrNotExist
+func (m *Memory) GetMetaCtx(ctx context.Context, path string) (map[string]string, error) {
+	_, meta, err := m.StatCtx(ctx, path)
+	return meta, err
+}
+
+// GetMeta - см. GetMetaCtx
+func (m *Memory) GetMeta(path string) (map[string]string, error) {
+	return m.GetMetaCtx(context.Background(), path)
+}
+
+// UpdateMetaCtx - изменяет метаданные файла без перезаписи его содержимого
+// ctx - контекст
+// path - путь к файлу
+// set - добавляемые и изменяемые ключи
+// unset - удаляемые ключи, удаляются до добавления set
+// Если файл не существует, возвращается ErrNotExist
+func (m *Memory) UpdateMetaCtx(ctx context.Context, path string, set map[string]string, unset []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := m.file("updatemeta", path)
+	if err != nil {
+		return err
+	}
+	meta, err := mergeMeta(f.meta, set, unset)
+	if err != nil {
+		return err
+	}
+	f.meta = copyMeta(meta)
+	return nil
+}
+
+// UpdateMeta - см. UpdateMetaCtx
+func (m *Memory) UpdateMeta(path string, set map[string]string, unset []string) error {
+	return m.UpdateMetaCtx(context.Background(), path, set, unset)
+}
+
+// ClearDirCtx - очищает директорию
+// ctx - контекст
+// path - путь к директории, корень хранилища - "."
+// Для пустого пути возвращается ErrNotExist, как в Local
+func (m *Memory) ClearDirCtx(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if path == "" {
+		return emptyPathError("open")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := cleanPath(path)
+	if _, err := m.dir("open", path); err != nil {
+		return err
+	}
+
+	for _, child := range m.descendants(name) {
+		delete(m.files, child)
+	}
+	return nil
+}
+
+// ClearDir - см. ClearDirCtx
+func (m *Memory) ClearDir(path string) error {
+	return m.ClearDirCtx(context.Background(), path)
+}
+
+// MkdirAllCtx - создает директорию вместе с родительскими
+// ctx - контекст
+// path - путь к директории
+func (m *Memory) MkdirAllCtx(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := cleanPath(path)
+	var dirs []string
+	for dir := name; !isRoot(dir); dir = pathpkg.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		f, ok := m.files[dirs[i]]
+		if ok && !f.isdir {
+			return memError("mkdir", dirs[i], syscall.ENOTDIR)
+		}
+		if !ok {
+			m.files[dirs[i]] = &memFile{isdir: true, modified: time.Now()}
+		}
+	}
+	return nil
+}
+
+// MkdirAll - см. MkdirAllCtx
+func (m *Memory) MkdirAll(path string) error {
+	return m.MkdirAllCtx(context.Background(), path)
+}
+
+// ReadDirCtx - возвращает содержимое директории, отсортированное по имени
+// ctx - контекст
+// path - путь к директории
+func (m *Memory) ReadDirCtx(ctx context.Context, path string) ([]os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	name := cleanPath(path)
+	if _, err := m.dir("open", path); err != nil {
+		return nil, err
+	}
+
+	children := m.children(name)
+	files := make([]os.FileInfo, 0, len(children))
+	for _, child := range children {
+		files = append(files, m.files[child].info(child))
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+
+	return files, nil
+}
+
+// ReadDir - см. ReadDirCtx
+func (m *Memory) ReadDir(path string) ([]os.FileInfo, error) {
+	return m.ReadDirCtx(context.Background(), path)
+}
+
+// WalkCtx - рекурсивно обходит директорию
+// ctx - контекст, при отмене которого обход прерывается
+// path - путь к директории
+// fn - функция, вызываемая для каждого файла и директории
+func (m *Memory) WalkCtx(ctx context.Context, path string, fn filepath.WalkFunc) error {
+	info, _, err := m.StatCtx(ctx, path)
+	if err != nil {
+		return fn(path, nil, err)
+	}
+	return walk(ctx, path, info, func(path string) ([]os.FileInfo, error) {
+		return m.ReadDirCtx(ctx, path)
+	}, fn)
+}
+
+// Walk - см. WalkCtx
+func (m *Memory) Walk(path string, fn filepath.WalkFunc) error {
+	return m.WalkCtx(context.Background(), path, fn)
+}
+
+// CopyCtx - копирует файл вместе с метаданными
+// ctx - контекст
+// src - путь к исходному файлу
+// dst - путь к новому файлу
+func (m *Memory) CopyCtx(ctx context.Context, src, dst string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := m.file("open", src)
+	if err != nil {
+		return err
+	}
+
+	meta := f.meta
+	if meta == nil {
+		meta = map[string]string{}
+	}
+	return m.write("open", dst, f.data, meta)
+}
+
+// Copy - см. CopyCtx
+func (m *Memory) Copy(src, dst string) error {
+	return m.CopyCtx(context.Background(), src, dst)
+}
+
+// MoveCtx - перемещает (переименовывает) файл или директорию вместе с метаданными
+// ctx - контекст
+// src - путь к исходному файлу
+// dst - путь к новому файлу
+func (m *Memory) MoveCtx(ctx context.Context, src, dst string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	from, to := cleanPath(src), cleanPath(dst)
+	f, ok := m.files[from]
+	if !ok {
+		return memError("rename", src, fs.ErrNotExist)
+	}
+	if _, err := m.dir("rename", pathpkg.Dir(to)); err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	if t, ok := m.files[to]; ok {
+		switch {
+		case t.isdir && !f.isdir:
+			return memError("rename", dst, syscall.EISDIR)
+		case !t.isdir && f.isdir:
+			return memError("rename", dst, syscall.ENOTDIR)
+		case t.isdir && len(m.children(to)) > 0:
+			return memError("rename", dst, syscall.ENOTEMPTY)
+		}
+	}
+
+	if f.isdir {
+		if strings.HasPrefix(to, from+"/") {
+			return memError("rename", dst, syscall.EINVAL)
+		}
+		for _, child := range m.descendants(from) {
+			m.files[to+strings.TrimPrefix(child, from)] = m.files[child]
+			delete(m.files, child)
+		}
+	}
+
+	m.files[to] = f
+	delete(m.files, from)
+	return nil
+}
+
+// Move - см. MoveCtx
+func (m *Memory) Move(src, dst string) error {
+	return m.MoveCtx(context.Background(), src, dst)
+}
+
+// CreateJsonFileCtx - создает файл с данными в формате JSON
+// ctx - контекст
+// path - путь к файлу
+// data - данные
+// meta - метаданные
+func (m *Memory) CreateJsonFileCtx(ctx context.Context, path string, data interface{}, meta map[string]string) error {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return m.CreateFileCtx(ctx, path, content, meta)
+}
+
+// CreateJsonFile - см. CreateJsonFileCtx
+func (m *Memory) CreateJsonFile(path string, data interface{}, meta map[string]string) error {
+	return m.CreateJsonFileCtx(context.Background(), path, data, meta)
+}
+
+// GetJsonFileCtx - возвращает содержимое файла в формате JSON
+// ctx - контекст
+// path - путь к файлу
+// file - переменная для десериализации
+// Если файл не существует, возвращается ErrNotExist. Если файл пуст, file не изменяется и ошибка не возвращается
+func (m *Memory) GetJsonFileCtx(ctx context.Context, path string, file interface{}) error {
+	content, err := m.GetFileCtx(ctx, path)
+	if err != nil {
+		return err
+	}
+	if len(content) == 0 {
+		return nil
+	}
+	return json.Unmarshal(content, file)
+}
+
+// GetJsonFile - см. GetJsonFileCtx
+func (m *Memory) GetJsonFile(path string, file interface{}) error {
+	return m.GetJsonFileCtx(context.Background(), path, file)
+}
+
+// write - записывает содержимое файла, родительская директория должна существовать.
+// Вызывается под блокировкой на запись
+func (m *Memory) write(op, path string, data []byte, meta map[string]string) error {
+	name := cleanPath(path)
+	if _, err := m.dir(op, pathpkg.Dir(name)); err != nil {
+		return err
+	}
+
+	f, ok := m.files[name]
+	if ok && f.isdir {
+		return memError(op, path, syscall.EISDIR)
+	}
+
+	nf := &memFile{data: data, modified: time.Now()}
+	if meta != nil {
+		nf.meta = copyMeta(meta)
+	} else if ok {
+		nf.meta = f.meta
+	}
+	m.files[name] = nf
+	return nil
+}
+
+// file - возвращает файл, который не является директорией
+func (m *Memory) file(op, path string) (*memFile, error) {
+	name := cleanPath(path)
+	if isRoot(name) {
+		return nil, memError(op, path, syscall.EISDIR)
+	}
+
+	f, ok := m.files[name]
+	if !ok {
+		return nil, memError(op, path, fs.ErrNotExist)
+	}
+	if f.isdir {
+		return nil, memError(op, path, syscall.EISDIR)
+	}
+	return f, nil
+}
+
+// dir - проверяет, что path является существующей директорией
+func (m *Memory) dir(op, path string) (*memFile, error) {
+	name := cleanPath(path)
+	if isRoot(name) {
+		return &memFile{isdir: true}, nil
+	}
+
+	f, ok := m.files[name]
+	if !ok {
+		return nil, memError(op, path, fs.ErrNotExist)
+	}
+	if !f.isdir {
+		return nil, memError(op, path, syscall.ENOTDIR)
+	}
+	return f, nil
+}
+
+// children - возвращает пути непосредственных потомков директории
+func (m *Memory) children(dir string) []string {
+	var names []string
+	for name := range m.files {
+		if name != dir && pathpkg.Dir(name) == dir {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// descendants - возвращает пути всех потомков директории
+func (m *Memory) descendants(dir string) []string {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	if dir == "." {
+		prefix = ""
+	}
+
+	var names []string
+	for name := range m.files {
+		if name != dir && strings.HasPrefix(name, prefix) && (prefix != "" || !strings.HasPrefix(name, "/")) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (f *memFile) info(name string) os.FileInfo {
+	return &File{
+		name:     pathpkg.Base(name),
+		size:     int64(len(f.data)),
+		modified: f.modified,
+		isdir:    f.isdir,
+	}
+}
+
+// cleanPath - приводит путь к каноническому виду
+func cleanPath(path string) string {
+	return pathpkg.Clean(filepath.ToSlash(path))
+}
+
+// isRoot - проверяет, является ли путь корнем хранилища
+func isRoot(name string) bool {
+	return name == "." || name == "/"
+}
+
+// memError - возвращает ошибку в том же виде, что и пакет os
+func memError(op, path string, err error) error {
+	return &fs.PathError{Op: op, Path: path, Err: err}
+}
+
+// copyMeta - возвращает копию метаданных, для пустых метаданных возвращается nil
+func copyMeta(meta map[string]string) map[string]string {
+	if len(meta) == 0 {
+		return nil
+	}
+	c := make(map[string]string, len(meta))
+	for key, value := range meta {
+		c[key] = value
+	}
+	return c
+}
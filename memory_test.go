@@ -0,0 +1,18 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/vlkalashnikov/go-store"
+	"github.com/vlkalashnikov/go-store/storetest"
+)
+
+func TestMemory(t *testing.T) {
+	storetest.RunConformance(t, func(t *testing.T) store.StoreIFace {
+		s, err := store.NewMemory(store.MemoryConfig{})
+		if err != nil {
+			t.Fatalf("NewMemory: %v", err)
+		}
+		return s
+	})
+}
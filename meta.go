@@ -0,0 +1,160 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	metaFormat  = "go-store/meta" // маркер формата мета-файла
+	metaVersion = 1               // версия формата мета-файла
+	maxMetaSize = 2 * 1024        // 2KB - ограничение S3 на размер пользовательских метаданных
+)
+
+// sidecar - содержимое мета-файла
+type sidecar struct {
+	Format  string            `json:"format"`
+	Version int               `json:"version"`
+	Meta    map[string]string `json:"meta"`
+}
+
+// normalizeMeta - приводит метаданные к виду, в котором их хранит S3:
+// ключи в нижнем регистре, допустимые для HTTP-заголовка, суммарный размер ключей и значений не больше 2KB.
+// Метаданные nil возвращаются без изменений
+// meta - метаданные
+func normalizeMeta(meta map[string]string) (map[string]string, error) {
+	if meta == nil {
+		return nil, nil
+	}
+
+	normalized := make(map[string]string, len(meta))
+	size := 0
+	for key, value := range meta {
+		name := strings.ToLower(strings.TrimSpace(key))
+		if !httpguts.ValidHeaderFieldName(name) {
+			return nil, fmt.Errorf("%w: key %q is not a valid header name", ErrInvalidMeta, key)
+		}
+		if _, ok := normalized[name]; ok {
+			return nil, fmt.Errorf("%w: duplicate key %q", ErrInvalidMeta, name)
+		}
+		normalized[name] = value
+		size += len(name) + len(value)
+	}
+	if size > maxMetaSize {
+		return nil, fmt.Errorf("%w: size %d exceeds %d bytes", ErrInvalidMeta, size, maxMetaSize)
+	}
+	return normalized, nil
+}
+
+// mergeMeta - возвращает метаданные current, из которых удалены ключи unset и в которые добавлены set.
+// Результат нормализуется, current не изменяется
+// current - текущие метаданные
+// set - добавляемые и изменяемые ключи
+// unset - удаляемые ключи
+func mergeMeta(current, set map[string]string, unset []string) (map[string]string, error) {
+	set, err := normalizeMeta(set)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]string, len(current)+len(set))
+	for key, value := range current {
+		merged[key] = value
+	}
+	for _, key := range unset {
+		delete(merged, strings.ToLower(strings.TrimSpace(key)))
+	}
+	for key, value := range set {
+		merged[key] = value
+	}
+	return normalizeMeta(merged)
+}
+
+// meta2Bytes - преобразует метаданные в содержимое мета-файла
+func meta2Bytes(meta map[string]string) []byte {
+	b, _ := json.Marshal(sidecar{Format: metaFormat, Version: metaVersion, Meta: meta})
+	return b
+}
+
+// bytes2Meta - преобразует содержимое мета-файла в метаданные.
+// Кроме текущего формата читаются мета-файлы старого формата "key=value" по одной паре в строке
+func bytes2Meta(b []byte) (map[string]string, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		return legacyBytes2Meta(b), nil
+	}
+
+	var s sidecar
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMeta, err)
+	}
+	if s.Format != metaFormat {
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidMeta, s.Format)
+	}
+	if s.Version > metaVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidMeta, s.Version)
+	}
+	return s.Meta, nil
+}
+
+// legacyBytes2Meta - читает мета-файл старого формата "key=value"
+func legacyBytes2Meta(b []byte) map[string]string {
+	meta := make(map[string]string)
+	for _, line := range strings.Split(string(b), "\n") {
+		// значение может содержать "=", ключ - нет
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		meta[strings.ToLower(key)] = value
+	}
+	return meta
+}
+
+// s3Meta - приводит метаданные, полученные от S3, к виду, в котором они были записаны
+func s3Meta(meta map[string]*string) map[string]string {
+	if len(meta) == 0 {
+		return nil
+	}
+
+	decoder := new(mime.WordDecoder)
+	result := make(map[string]string, len(meta))
+	for key, value := range meta {
+		v := aws.StringValue(value)
+		if decoded, err := decoder.DecodeHeader(v); err == nil {
+			v = decoded
+		}
+		result[strings.ToLower(key)] = v
+	}
+	return result
+}
+
+// s3MetaInput - кодирует метаданные для заголовков x-amz-meta-.
+// Значения с символами вне печатного ASCII кодируются по RFC 2047, так же как их возвращает S3
+func s3MetaInput(meta map[string]string) map[string]*string {
+	if meta == nil {
+		return nil
+	}
+
+	result := make(map[string]*string, len(meta))
+	for key, value := range meta {
+		result[key] = aws.String(s3MetaValue(value))
+	}
+	return result
+}
+
+// s3MetaValue - кодирует значение метаданных для заголовка x-amz-meta-.
+// S3 обрезает пробелы по краям значения, а s3Meta декодирует все, что похоже на слово RFC 2047,
+// поэтому такие значения кодируются всегда, иначе они не вернутся в исходном виде
+func s3MetaValue(value string) string {
+	if strings.Contains(value, "=?") || strings.TrimSpace(value) != value {
+		return "=?utf-8?b?" + base64.StdEncoding.EncodeToString([]byte(value)) + "?="
+	}
+	return mime.QEncoding.Encode("utf-8", value)
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PresignIFace - хранилище, которое выдает ссылки для скачивания и загрузки файлов в обход сервиса.
+// Реализуется S3 (подпись AWS) и Local, WebDav (подпись HMAC, ссылки обслуживает NewPresignHandler)
+type PresignIFace interface {
+	// PresignGet - возвращает ссылку для скачивания файла (GET, HEAD, Range), действующую ttl
+	PresignGet(path string, ttl time.Duration) (string, error)
+	// PresignPut - возвращает ссылку для загрузки файла с метаданными meta (PUT), действующую ttl,
+	// и заголовки, которые клиент должен передать вместе с запросом
+	PresignPut(path string, ttl time.Duration, meta map[string]string) (string, http.Header, error)
+}
+
+// PresignConfig - параметры ссылок, подписанных HMAC, для Local и WebDav
+type PresignConfig struct {
+	// PresignSecret - ключ подписи, тот же ключ передается в NewPresignHandler
+	PresignSecret string
+	// PresignBaseURL - адрес, по которому доступен NewPresignHandler, например "https://example.com/files"
+	PresignBaseURL string
+}
+
+// presign - подписывает ссылку на файл path хранилища для метода method.
+// Подпись HMAC-SHA256 охватывает метод, путь, срок действия и метаданные
+// cfg - параметры ссылок
+// method - http.MethodGet или http.MethodPut
+// path - путь к файлу относительно корня хранилища
+// ttl - срок действия ссылки
+// meta - метаданные файла для PUT
+func presign(cfg PresignConfig, method, path string, ttl time.Duration, meta map[string]string) (string, error) {
+	if cfg.PresignSecret == "" || cfg.PresignBaseURL == "" {
+		return "", ErrPresignNotConfigured
+	}
+	path, err := relPath(path)
+	if err != nil {
+		return "", err
+	}
+	meta, err = normalizeMeta(meta)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("method", method)
+	q.Set("expires", strconv.FormatInt(time.Now().Add(ttl).Unix(), 10))
+	if meta != nil {
+		b, _ := json.Marshal(meta)
+		q.Set("meta", base64.RawURLEncoding.EncodeToString(b))
+	}
+	q.Set("signature", presignSignature(cfg.PresignSecret, path, q))
+
+	return strings.TrimSuffix(cfg.PresignBaseURL, "/") + (&url.URL{Path: "/" + path}).EscapedPath() + "?" + q.Encode(), nil
+}
+
+// presignSignature - возвращает подпись ссылки в шестнадцатеричном виде
+func presignSignature(secret, path string, q url.Values) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{q.Get("method"), path, q.Get("expires"), q.Get("meta")}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewPresignHandler - возвращает http.Handler, который обслуживает ссылки PresignGet и PresignPut хранилищ Local и WebDav.
+// Путь запроса после "/" - путь к файлу, поэтому если PresignBaseURL содержит путь, handler монтируется через http.StripPrefix.
+// Ссылки GET обслуживают GET и HEAD с поддержкой Range, ссылки PUT записывают тело запроса через StreamToFileWithMeta.
+// Просроченные ссылки и ссылки с неверной подписью отклоняются с 403
+// s - хранилище, для которого выданы ссылки
+// secret - ключ подписи, см. PresignConfig
+func NewPresignHandler(s StoreIFace, secret string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/")
+		q := r.URL.Query()
+
+		method := r.Method
+		if method == http.MethodHead {
+			method = http.MethodGet
+		}
+		if q.Get("method") != method {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		signature := presignSignature(secret, path, q)
+		if !hmac.Equal([]byte(signature), []byte(q.Get("signature"))) {
+			http.Error(w, "invalid signature", http.StatusForbidden)
+			return
+		}
+		expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+		if err != nil || time.Now().Unix() > expires {
+			http.Error(w, "link expired", http.StatusForbidden)
+			return
+		}
+
+		if method == http.MethodGet {
+			serveFile(w, r, s, path)
+			return
+		}
+
+		var meta map[string]string
+		if encoded := q.Get("meta"); encoded != "" {
+			b, err := base64.RawURLEncoding.DecodeString(encoded)
+			if err == nil {
+				err = json.Unmarshal(b, &meta)
+			}
+			if err != nil {
+				http.Error(w, "invalid metadata", http.StatusBadRequest)
+				return
+			}
+		}
+		if err := s.StreamToFileWithMetaCtx(r.Context(), r.Body, path, meta); err != nil {
+			httpError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+}
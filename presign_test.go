@@ -0,0 +1,152 @@
+package store_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vlkalashnikov/go-store"
+)
+
+const presignSecret = "secret"
+
+func TestPresignLocal(t *testing.T) {
+	srv := httptest.NewUnstartedServer(nil)
+	presign := store.PresignConfig{PresignSecret: presignSecret, PresignBaseURL: "http://" + srv.Listener.Addr().String() + "/files"}
+	s, err := store.NewLocal(store.LocalConfig{Root: t.TempDir(), PresignConfig: presign})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPresign(t, srv, s)
+}
+
+func TestPresignWebDav(t *testing.T) {
+	srv := httptest.NewUnstartedServer(nil)
+	presign := store.PresignConfig{PresignSecret: presignSecret, PresignBaseURL: "http://" + srv.Listener.Addr().String() + "/files"}
+	s, err := store.NewWebDav(store.WebDavConfig{WebDavHost: newWebDavServer(t), PresignConfig: presign})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPresign(t, srv, s)
+}
+
+func TestPresignNotConfigured(t *testing.T) {
+	s, err := store.NewLocal(store.LocalConfig{Root: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.(store.PresignIFace).PresignGet("file.txt", time.Minute); !errors.Is(err, store.ErrPresignNotConfigured) {
+		t.Fatalf("PresignGet error = %v, want ErrPresignNotConfigured", err)
+	}
+}
+
+// TestPresignS3 - проверяет, что ссылки S3 подписаны и метаданные передаются в заголовках
+func TestPresignS3(t *testing.T) {
+	srv := newFakeS3(t)
+	s := newS3(t, srv, store.S3Config{}).(store.PresignIFace)
+
+	putURL, header, err := s.PresignPut("file.txt", time.Minute, map[string]string{"Author": "store"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(putURL, "X-Amz-Signature=") || header.Get("X-Amz-Meta-Author") != "store" {
+		t.Fatalf("PresignPut = %s, %v", putURL, header)
+	}
+	req, _ := http.NewRequest(http.MethodPut, putURL, strings.NewReader("data"))
+	req.Header = header
+	doRequest(t, req, http.StatusOK)
+
+	getURL, err := s.PresignGet("file.txt", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ = http.NewRequest(http.MethodGet, getURL, nil)
+	if body := doRequest(t, req, http.StatusOK); body != "data" {
+		t.Fatalf("GET presigned URL = %q, want data", body)
+	}
+}
+
+// testPresign - проверяет ссылки Local и WebDav, обслуживаемые NewPresignHandler.
+// srv еще не запущен, его адрес уже указан в PresignBaseURL
+func testPresign(t *testing.T, srv *httptest.Server, s store.StoreIFace) {
+	srv.Config.Handler = http.StripPrefix("/files", store.NewPresignHandler(s, presignSecret))
+	srv.Start()
+	t.Cleanup(srv.Close)
+	presigner := s.(store.PresignIFace)
+	if err := s.MkdirAll("dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	putURL, header, err := presigner.PresignPut("dir/file name.txt", time.Minute, map[string]string{"author": "store"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodPut, putURL, strings.NewReader("0123456789"))
+	req.Header = header
+	doRequest(t, req, http.StatusCreated)
+	if meta, err := s.GetMeta("dir/file name.txt"); err != nil || meta["author"] != "store" {
+		t.Fatalf("GetMeta = %v, %v; want author=store", meta, err)
+	}
+
+	getURL, err := presigner.PresignGet("dir/file name.txt", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ = http.NewRequest(http.MethodGet, getURL, nil)
+	if body := doRequest(t, req, http.StatusOK); body != "0123456789" {
+		t.Fatalf("GET = %q", body)
+	}
+	req, _ = http.NewRequest(http.MethodGet, getURL, nil)
+	req.Header.Set("Range", "bytes=2-5")
+	if body := doRequest(t, req, http.StatusPartialContent); body != "2345" {
+		t.Fatalf("GET Range = %q, want 2345", body)
+	}
+
+	// ссылка GET не позволяет загрузить файл
+	req, _ = http.NewRequest(http.MethodPut, getURL, strings.NewReader("new"))
+	doRequest(t, req, http.StatusMethodNotAllowed)
+
+	// подпись не подходит к другому пути
+	req, _ = http.NewRequest(http.MethodGet, strings.Replace(getURL, "file%20name", "other", 1), nil)
+	doRequest(t, req, http.StatusForbidden)
+
+	expiredURL, err := presigner.PresignGet("dir/file name.txt", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ = http.NewRequest(http.MethodGet, expiredURL, nil)
+	doRequest(t, req, http.StatusForbidden)
+
+	missingURL, err := presigner.PresignGet("dir/missing.txt", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ = http.NewRequest(http.MethodGet, missingURL, nil)
+	doRequest(t, req, http.StatusNotFound)
+
+	if _, err := presigner.PresignGet("../outside.txt", time.Minute); !errors.Is(err, store.ErrOutsideRoot) {
+		t.Fatalf("PresignGet outside root error = %v, want ErrOutsideRoot", err)
+	}
+}
+
+// doRequest - выполняет запрос, проверяет статус ответа и возвращает тело
+func doRequest(t *testing.T, req *http.Request, status int) string {
+	t.Helper()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != status {
+		t.Fatalf("%s %s: status %d, want %d: %s", req.Method, req.URL, resp.StatusCode, status, body)
+	}
+	return string(body)
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory - создает хранилище по конфигурации.
+// Встроенные хранилища используют свои поля Config, сторонние - Config.URL
+type Factory func(cfg Config) (StoreIFace, error)
+
+var backends = struct {
+	sync.RWMutex
+	factories map[string]Factory
+}{
+	factories: make(map[string]Factory),
+}
+
+func init() {
+	Register(LocalStore, func(cfg Config) (StoreIFace, error) { return NewLocal(cfg.LocalConfig) })
+	Register(WebDavStore, func(cfg Config) (StoreIFace, error) { return NewWebDav(cfg.WebDavConfig) })
+	Register(S3Store, func(cfg Config) (StoreIFace, error) { return NewS3(cfg.S3Config) })
+	Register(EmptyStore, func(cfg Config) (StoreIFace, error) { return NewEmpty(cfg.EmptyConfig) })
+	Register(MemoryStore, func(cfg Config) (StoreIFace, error) { return NewMemory(cfg.MemoryConfig) })
+}
+
+// Register - регистрирует хранилище с именем name, обычно вызывается из init() пакета хранилища.
+// Имя используется как Config.StoreType, как STORE_TYPE и как схема URL в NewFromURL.
+// Повторная регистрация имени, пустое имя, схема URL встроенного хранилища (file, mem и т.д.)
+// или nil factory вызывают панику, как в database/sql.Register
+// name - имя хранилища
+// factory - функция создания хранилища
+func Register(name string, factory Factory) {
+	backends.Lock()
+	defer backends.Unlock()
+
+	if name == "" {
+		panic("store: Register with empty name")
+	}
+	if factory == nil {
+		panic("store: Register factory is nil")
+	}
+	if storeType, ok := urlSchemes[name]; ok && storeType != name {
+		panic("store: Register name " + name + " is reserved for URL scheme of " + storeType)
+	}
+	if _, dup := backends.factories[name]; dup {
+		panic("store: Register called twice for " + name)
+	}
+	backends.factories[name] = factory
+}
+
+// Backends - возвращает отсортированные имена зарегистрированных хранилищ
+func Backends() []string {
+	backends.RLock()
+	defer backends.RUnlock()
+
+	names := make([]string, 0, len(backends.factories))
+	for name := range backends.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupBackend - возвращает функцию создания зарегистрированного хранилища
+func lookupBackend(name string) (Factory, error) {
+	backends.RLock()
+	defer backends.RUnlock()
+
+	factory, ok := backends.factories[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownStore, name)
+	}
+	return factory, nil
+}
@@ -0,0 +1,71 @@
+package store_test
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/vlkalashnikov/go-store"
+)
+
+// registered - URL, с которым последний раз создавалось тестовое хранилище
+var registered *url.URL
+
+func init() {
+	store.Register("testbackend", func(cfg store.Config) (store.StoreIFace, error) {
+		registered = cfg.URL
+		return store.NewMemory(store.MemoryConfig{})
+	})
+}
+
+func TestRegister(t *testing.T) {
+	s, err := store.NewFromURL("testbackend://host/root?option=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateFile("file.txt", []byte("data"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if registered == nil || registered.Host != "host" || registered.Query().Get("option") != "1" {
+		t.Fatalf("factory got URL %v", registered)
+	}
+
+	if _, err := store.New(store.Config{StoreType: "testbackend"}); err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := store.New(store.Config{StoreType: "unknown"}); !errors.Is(err, store.ErrUnknownStore) {
+		t.Fatalf("New(unknown) error = %v, want ErrUnknownStore", err)
+	}
+	if _, err := store.NewFromURL("unknown://host"); !errors.Is(err, store.ErrUnknownStore) {
+		t.Fatalf("NewFromURL(unknown) error = %v, want ErrUnknownStore", err)
+	}
+
+	want := []string{store.EmptyStore, store.LocalStore, store.MemoryStore, store.S3Store, "testbackend", store.WebDavStore}
+	if got := store.Backends(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Backends = %v, want %v", got, want)
+	}
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("duplicate Register did not panic")
+		}
+	}()
+	store.Register(store.LocalStore, func(cfg store.Config) (store.StoreIFace, error) { return nil, nil })
+}
+
+// TestRegisterBuiltinScheme - схемы URL встроенных хранилищ разбираются ConfigFromURL и не могут быть зарегистрированы
+func TestRegisterBuiltinScheme(t *testing.T) {
+	for _, name := range []string{"file", "mem", "webdav+https"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("Register(%q) did not panic", name)
+				}
+			}()
+			store.Register(name, func(cfg store.Config) (store.StoreIFace, error) { return nil, nil })
+		}()
+	}
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutsideRoot - путь выходит за пределы корня хранилища
+var ErrOutsideRoot = errors.New("path is outside of store root")
+
+// relPath - проверяет, что путь не выходит за пределы корня, и возвращает его в каноническом виде.
+// Абсолютные пути и пути, которые после очистки начинаются с "..", отклоняются
+// p - путь относительно корня хранилища
+func relPath(p string) (string, error) {
+	slashed := filepath.ToSlash(p)
+	if path.IsAbs(slashed) || filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return "", outsideRoot(p)
+	}
+
+	clean := path.Clean(slashed)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", outsideRoot(p)
+	}
+	return clean, nil
+}
+
+// emptyPathError - ошибка ClearDir для пустого пути.
+// Пустой путь не обозначает корень хранилища (корень - "."), поэтому ClearDir("") ничего не удаляет,
+// как os.Open("") в Local без корня
+// op - операция
+func emptyPathError(op string) error {
+	return &fs.PathError{Op: op, Path: "", Err: ErrNotExist}
+}
+
+// joinRoot - возвращает путь p внутри корня root с разделителем "/".
+// Если root пустой, путь возвращается без изменений
+// root - корень хранилища
+// p - путь относительно корня хранилища
+func joinRoot(root, p string) (string, error) {
+	if root == "" {
+		return p, nil
+	}
+	rel, err := relPath(p)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(root, rel), nil
+}
+
+// withinRoot - проверяет, что путь target находится внутри root.
+// Оба пути должны быть абсолютными и не содержать символических ссылок
+func withinRoot(root, target string) bool {
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// evalExisting - раскрывает символические ссылки в существующей части пути,
+// несуществующий остаток пути добавляется без изменений.
+// Висячие ссылки тоже раскрываются, иначе через них можно создать файл вне корня
+func evalExisting(p string) (string, error) {
+	var tail []string
+	for {
+		real, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(append([]string{real}, tail...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		if target, linkErr := os.Readlink(p); linkErr == nil {
+			// висячая ссылка: проверяется путь, на который она указывает
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(p), target)
+			}
+			return evalExisting(filepath.Join(append([]string{target}, tail...)...))
+		}
+
+		parent := filepath.Dir(p)
+		if parent == p {
+			return "", err
+		}
+		tail = append([]string{filepath.Base(p)}, tail...)
+		p = parent
+	}
+}
+
+func outsideRoot(p string) error {
+	return &fs.PathError{Op: "resolve", Path: p, Err: ErrOutsideRoot}
+}
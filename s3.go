@@ -2,10 +2,19 @@ package store
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -51,112 +60,309 @@ func (f File) Sys() interface{} {
 	return nil
 }
 
+// переменные, а не константы, чтобы тесты могли проверить копирование по частям на небольших объектах
+var (
+	maxCopyObjectSize int64 = 5 * 1024 * 1024 * 1024 // 5GB - максимальный размер объекта для CopyObject
+	copyPartSize      int64 = 512 * 1024 * 1024      // 512MB - размер части при копировании по частям
+)
+
+const (
+	maxPartsCount      = 10000                  // максимальное количество частей в multipart upload
+	minPartSize        = 5 * 1024 * 1024        // 5MB - минимальный размер части multipart upload, кроме последней
+	maxPartSize        = 5 * 1024 * 1024 * 1024 // 5GB - максимальный размер части multipart upload
+	partsPerGrowth     = 1000                   // через сколько частей удваивается размер части потока неизвестной длины
+	defaultConcurrency = 4                      // количество одновременно загружаемых частей по умолчанию
+	deleteBatchSize    = 1000                   // максимальное количество ключей в DeleteObjects
+)
+
 type S3 struct {
 	client   *s3.S3
 	S3Bucket *string
+	prefix   string
+
+	partSize     int64
+	concurrency  int
+	memoryBudget int64
 }
 
 func (s *S3) init(cfg S3Config) error {
 	s.client = s3.New(session.Must(session.NewSession(&cfg.Config)))
 	s.S3Bucket = aws.String(cfg.S3Bucket)
+	s.prefix = strings.Trim(cfg.S3Prefix, "/")
+
+	s.partSize = cfg.S3PartSize
+	if s.partSize < minPartSize {
+		s.partSize = minPartSize
+	}
+	if s.partSize > maxPartSize {
+		s.partSize = maxPartSize
+	}
+	s.concurrency = cfg.S3Concurrency
+	if s.concurrency <= 0 {
+		s.concurrency = defaultConcurrency
+	}
+	s.memoryBudget = cfg.S3MemoryBudget
+	if s.memoryBudget <= 0 {
+		s.memoryBudget = s.partSize * int64(s.concurrency)
+	}
 	return nil
 }
 
-// IsExist - проверяет существование файла
+// resolve - возвращает ключ объекта внутри S3Prefix.
+// Пути, выходящие за пределы префикса, отклоняются
+// path - путь относительно корня хранилища
+func (s *S3) resolve(path string) (string, error) {
+	return joinRoot(s.prefix, path)
+}
+
+// IsExistCtx - проверяет существование файла или директории.
+// Корень хранилища "." существует всегда, как в Local. Директория существует, если есть хотя бы один ключ с ее префиксом
+// ctx - контекст
 // filePath - путь к файлу
-func (s *S3) IsExist(filePath string) bool {
-	_, err := s.client.HeadObject(&s3.HeadObjectInput{
+func (s *S3) IsExistCtx(ctx context.Context, filePath string) bool {
+	key, err := s.resolve(filePath)
+	if err != nil {
+		return false
+	}
+	if isRoot(cleanPath(filePath)) {
+		return true
+	}
+
+	_, err = s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
 		Bucket: s.S3Bucket,
-		Key:    aws.String(filePath),
+		Key:    aws.String(key),
 	})
-
-	if err != nil {
-		if awsErr, ok := err.(awserr.Error); ok {
-			if awsErr.Code() == "NotFound" {
-				return false
-			}
-		}
+	if err == nil {
+		return true
+	}
+	if !errors.Is(mapError(err), ErrNotExist) {
 		return false
 	}
 
-	return true
+	// директория - это префикс ключей, для которого HeadObject не находит объекта
+	out, err := s.client.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:  s.S3Bucket,
+		Prefix:  aws.String(dirPrefix(key)),
+		MaxKeys: aws.Int64(1),
+	})
+	return err == nil && len(out.Contents) > 0
+}
+
+// IsExist - см. IsExistCtx
+func (s *S3) IsExist(filePath string) bool {
+	return s.IsExistCtx(context.Background(), filePath)
 }
 
-// CreateFile - создает файл
+// CreateFileCtx - создает файл
+// ctx - контекст
 // path - путь к файлу
 // file - содержимое файла
 // meta - метаданные файла
-func (s *S3) CreateFile(path string, file []byte, meta map[string]string) error {
-	_, err := s.client.PutObject(&s3.PutObjectInput{
+func (s *S3) CreateFileCtx(ctx context.Context, path string, file []byte, meta map[string]string) error {
+	key, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+	meta, err = normalizeMeta(meta)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
 		Bucket:   s.S3Bucket,
-		Key:      aws.String(path),
+		Key:      aws.String(key),
 		Body:     bytes.NewReader(file),
-		Metadata: aws.StringMap(meta),
+		Metadata: s3MetaInput(meta),
 	})
 
-	return err
+	return mapError(err)
+}
+
+// CreateFile - см. CreateFileCtx
+func (s *S3) CreateFile(path string, file []byte, meta map[string]string) error {
+	return s.CreateFileCtx(context.Background(), path, file, meta)
 }
 
-// StreamToFile - записывает содержимое потока в файл
+// StreamToFileCtx - записывает содержимое потока в файл без метаданных, см. StreamToFileWithMetaCtx
+// ctx - контекст
 // stream - поток
 // path - путь к файлу
+func (s *S3) StreamToFileCtx(ctx context.Context, stream io.Reader, path string) error {
+	return s.StreamToFileWithMetaCtx(ctx, stream, path, nil)
+}
+
+// StreamToFile - см. StreamToFileCtx
 func (s *S3) StreamToFile(stream io.Reader, path string) error {
-	buf := make([]byte, 1024*1024*5) // 5MB
+	return s.StreamToFileCtx(context.Background(), stream, path)
+}
 
-	resp, err := s.client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
-		Bucket: s.S3Bucket,
-		Key:    aws.String(path),
-	})
+// StreamToFileWithMetaCtx - записывает содержимое потока в файл через multipart upload.
+// Метаданные передаются в CreateMultipartUpload и появляются у объекта вместе с данными при завершении загрузки.
+// Части читаются из потока целиком (io.ReadFull) и загружаются параллельно,
+// количество одновременно загружаемых частей ограничено S3Concurrency, а память под них - S3MemoryBudget.
+// Если размер потока известен (Len() или io.Seeker), размер части выбирается так, чтобы уложиться в maxPartsCount,
+// иначе размер части удваивается каждые partsPerGrowth частей
+// ctx - контекст, при отмене которого загрузка прерывается, а multipart upload отменяется
+// stream - поток
+// path - путь к файлу
+// meta - метаданные файла
+func (s *S3) StreamToFileWithMetaCtx(ctx context.Context, stream io.Reader, path string, meta map[string]string) error {
+	key, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+	meta, err = normalizeMeta(meta)
 	if err != nil {
 		return err
 	}
 
-	var partNumber int64 = 1
-	var completedParts []*s3.CompletedPart
+	resp, err := s.client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:   s.S3Bucket,
+		Key:      aws.String(key),
+		Metadata: s3MetaInput(meta),
+	})
+	if err != nil {
+		return mapError(err)
+	}
 
-	for {
-		n, err := stream.Read(buf)
-		if err != nil && err != io.EOF {
-			return err
+	completedParts, err := s.uploadParts(ctx, resp, stream)
+	if err != nil {
+		if abortErr := s.abortMultipartUpload(resp); abortErr != nil {
+			return mapError(abortErr)
 		}
-		if n == 0 {
-			break
+		return mapError(err)
+	}
+
+	if len(completedParts) == 0 {
+		// S3 не позволяет завершить multipart upload без частей, поэтому пустой файл создается через PutObject
+		if err := s.abortMultipartUpload(resp); err != nil {
+			return mapError(err)
 		}
+		return s.CreateFileCtx(ctx, path, nil, meta)
+	}
 
-		//fmt.Println("Uploading part", partNumber, "of", path, "size:", n)
+	_, err = s.completeMultipartUpload(ctx, resp, completedParts)
 
-		completedPart, err := s.client.UploadPart(&s3.UploadPartInput{
-			Bucket:     s.S3Bucket,
-			Key:        aws.String(path),
-			UploadId:   resp.UploadId,
-			PartNumber: aws.Int64(partNumber),
-			Body:       bytes.NewReader(buf[:n]),
-		})
+	return mapError(err)
+}
 
-		if err != nil {
-			if abortErr := s.abortMultipartUpload(resp); abortErr != nil {
-				return abortErr
+// uploadParts - читает поток по частям и загружает их пулом из S3Concurrency горутин.
+// Возвращает загруженные части, упорядоченные по номеру
+func (s *S3) uploadParts(ctx context.Context, resp *s3.CreateMultipartUploadOutput, stream io.Reader) ([]*s3.CompletedPart, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		parts    []*s3.CompletedPart
+	)
+	setErr := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	size, sized := streamSize(stream)
+	sizer := newPartSizer(s.partSize, size, sized)
+	workers := make(chan struct{}, s.concurrency)
+	memory := newMemoryBudget(s.memoryBudget)
+
+	for partNumber := int64(1); ; partNumber++ {
+		// после ошибки загрузки части не занимаем память и не читаем из потока следующую часть
+		if err := ctx.Err(); err != nil {
+			setErr(err)
+			break
+		}
+		partSize := sizer.size(partNumber)
+		memory.acquire(partSize)
+		// пока ждали бюджет памяти, загрузка другой части могла завершиться ошибкой
+		if err := ctx.Err(); err != nil {
+			memory.release(partSize)
+			setErr(err)
+			break
+		}
+		buf := make([]byte, partSize)
+
+		// io.ReadFull не дает короткому чтению из потока превратиться в недопустимо маленькую часть
+		n, err := io.ReadFull(stream, buf)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if last {
+			err = nil
+		}
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err == nil && n > 0 && partNumber > maxPartsCount {
+			err = fmt.Errorf("stream exceeds %d parts of multipart upload", maxPartsCount)
+		}
+		if err != nil || n == 0 {
+			memory.release(partSize)
+			if err != nil {
+				setErr(err)
 			}
-			return err
+			break
 		}
 
-		completedParts = append(completedParts, &s3.CompletedPart{
-			ETag:       completedPart.ETag,
-			PartNumber: aws.Int64(partNumber),
-		})
+		workers <- struct{}{}
+		wg.Add(1)
+		go func(partNumber int64, body []byte) {
+			defer func() {
+				memory.release(partSize)
+				<-workers
+				wg.Done()
+			}()
 
-		partNumber++
+			out, err := s.client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+				Bucket:     resp.Bucket,
+				Key:        resp.Key,
+				UploadId:   resp.UploadId,
+				PartNumber: aws.Int64(partNumber),
+				Body:       bytes.NewReader(body),
+			})
+			if err != nil {
+				setErr(err)
+				return
+			}
+
+			mu.Lock()
+			parts = append(parts, &s3.CompletedPart{
+				ETag:       out.ETag,
+				PartNumber: aws.Int64(partNumber),
+			})
+			mu.Unlock()
+		}(partNumber, buf[:n])
+
+		if last {
+			break
+		}
+	}
+
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
 	}
 
-	_, err = s.completeMultipartUpload(resp, completedParts)
+	sort.Slice(parts, func(i, j int) bool {
+		return *parts[i].PartNumber < *parts[j].PartNumber
+	})
+	return parts, nil
+}
 
-	return err
+// StreamToFileWithMeta - см. StreamToFileWithMetaCtx
+func (s *S3) StreamToFileWithMeta(stream io.Reader, path string, meta map[string]string) error {
+	return s.StreamToFileWithMetaCtx(context.Background(), stream, path, meta)
 }
 
-// GetFile - получает файл
+// GetFileCtx - получает файл
+// ctx - контекст
 // path - путь к файлу
-func (s *S3) GetFile(path string) ([]byte, error) {
-	stream, err := s.FileReader(path, 0, 0)
+func (s *S3) GetFileCtx(ctx context.Context, path string) ([]byte, error) {
+	stream, err := s.FileReaderCtx(ctx, path, 0, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -166,13 +372,19 @@ func (s *S3) GetFile(path string) ([]byte, error) {
 	return io.ReadAll(stream)
 }
 
-// GetFilePartially - получает часть файла
+// GetFile - см. GetFileCtx
+func (s *S3) GetFile(path string) ([]byte, error) {
+	return s.GetFileCtx(context.Background(), path)
+}
+
+// GetFilePartiallyCtx - получает часть файла
+// ctx - контекст
 // path - путь к файлу
 // offset - смещение от начала
 // length - длина
 // https://www.rfc-editor.org/rfc/rfc9110.html#name-range
-func (s *S3) GetFilePartially(path string, offset, length int64) ([]byte, error) {
-	stream, err := s.FileReader(path, offset, length)
+func (s *S3) GetFilePartiallyCtx(ctx context.Context, path string, offset, length int64) ([]byte, error) {
+	stream, err := s.FileReaderCtx(ctx, path, offset, length)
 	if err != nil {
 		return nil, err
 	}
@@ -182,126 +394,481 @@ func (s *S3) GetFilePartially(path string, offset, length int64) ([]byte, error)
 	return io.ReadAll(stream)
 }
 
-// FileReader - возвращает io.ReadCloser для чтения файла
+// GetFilePartially - см. GetFilePartiallyCtx
+func (s *S3) GetFilePartially(path string, offset, length int64) ([]byte, error) {
+	return s.GetFilePartiallyCtx(context.Background(), path, offset, length)
+}
+
+// FileReaderCtx - возвращает io.ReadCloser для чтения файла
+// ctx - контекст, при отмене которого чтение прерывается
 // path - путь к файлу
 // offset - смещение от начала
 // length - длина
-func (s *S3) FileReader(path string, offset, length int64) (io.ReadCloser, error) {
-	_range := ""
+// Для чтения файла целиком (offset = 0, length <= 0) Range не передается,
+// т.к. S3 отвечает 416 на "bytes=0-" для пустых объектов
+func (s *S3) FileReaderCtx(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	key, err := s.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: s.S3Bucket,
+		Key:    aws.String(key),
+	}
 
 	if length > 0 {
-		_range = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
-	} else {
-		_range = fmt.Sprintf("bytes=%d-", offset)
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
 	}
 
-	out, err := s.client.GetObject(&s3.GetObjectInput{
-		Bucket: s.S3Bucket,
-		Key:    aws.String(path),
-		Range:  aws.String(_range),
-	})
+	out, err := s.client.GetObjectWithContext(ctx, input)
 
 	if err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
 
 	return out.Body, nil
 }
 
-// RemoveFile - удаляет файл
+// FileReader - см. FileReaderCtx
+func (s *S3) FileReader(path string, offset, length int64) (io.ReadCloser, error) {
+	return s.FileReaderCtx(context.Background(), path, offset, length)
+}
+
+// RemoveFileCtx - удаляет файл
+// ctx - контекст
 // path - путь к файлу
-func (s *S3) RemoveFile(path string) error {
-	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+func (s *S3) RemoveFileCtx(ctx context.Context, path string) error {
+	key, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
 		Bucket: s.S3Bucket,
-		Key:    aws.String(path),
+		Key:    aws.String(key),
 	})
 
-	return err
+	return mapError(err)
+}
+
+// RemoveFile - см. RemoveFileCtx
+func (s *S3) RemoveFile(path string) error {
+	return s.RemoveFileCtx(context.Background(), path)
 }
 
-// Stat - возвращает информацию о файле
+// StatCtx - возвращает информацию о файле
+// ctx - контекст
 // path - путь к файлу
 // os.FileInfo - возвращается неполный
-func (s *S3) Stat(path string) (os.FileInfo, map[string]string, error) {
-	out, err := s.client.HeadObject(&s3.HeadObjectInput{
+func (s *S3) StatCtx(ctx context.Context, path string) (os.FileInfo, map[string]string, error) {
+	key, err := s.resolve(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
 		Bucket: s.S3Bucket,
-		Key:    aws.String(path),
+		Key:    aws.String(key),
 	})
 
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, mapError(err)
 	}
 
 	f := new(File)
-	f.name = path
+	f.name = pathpkg.Base(cleanPath(path))
 	f.size = *out.ContentLength
 	f.modified = *out.LastModified
 
-	return f, aws.StringValueMap(out.Metadata), nil
+	return f, s3Meta(out.Metadata), nil
 }
 
-// ClearDir - очищает директорию
-// path - путь к директории
-func (s *S3) ClearDir(path string) error {
-	list, err := s.client.ListObjectsV2(&s3.ListObjectsV2Input{
+// Stat - см. StatCtx
+func (s *S3) Stat(path string) (os.FileInfo, map[string]string, error) {
+	return s.StatCtx(context.Background(), path)
+}
+
+// GetMetaCtx - возвращает метаданные файла
+// ctx - контекст
+// path - путь к файлу
+// Если файл не существует, возвращается ErrNotExist
+func (s *S3) GetMetaCtx(ctx context.Context, path string) (map[string]string, error) {
+	_, meta, err := s.StatCtx(ctx, path)
+	return meta, err
+}
+
+// GetMeta - см. GetMetaCtx
+func (s *S3) GetMeta(path string) (map[string]string, error) {
+	return s.GetMetaCtx(context.Background(), path)
+}
+
+// UpdateMetaCtx - изменяет метаданные файла без перезаписи его содержимого.
+// Объект копируется сам в себя на стороне сервера (CopyObject с MetadataDirective REPLACE),
+// системные заголовки, класс хранения, шифрование и теги объекта сохраняются.
+// ACL объекта не сохраняется: копия получает ACL бакета по умолчанию.
+// Если объект изменился после чтения метаданных, возвращается ErrExist
+// ctx - контекст
+// path - путь к файлу
+// set - добавляемые и изменяемые ключи
+// unset - удаляемые ключи, удаляются до добавления set
+// Если файл не существует, возвращается ErrNotExist
+func (s *S3) UpdateMetaCtx(ctx context.Context, path string, set map[string]string, unset []string) error {
+	key, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	head, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
 		Bucket: s.S3Bucket,
-		Prefix: aws.String(path),
+		Key:    aws.String(key),
 	})
+	if err != nil {
+		return mapError(err)
+	}
 
+	meta, err := mergeMeta(s3Meta(head.Metadata), set, unset)
 	if err != nil {
 		return err
 	}
+	head.Metadata = s3MetaInput(meta)
 
-	for _, obj := range list.Contents {
-		_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
-			Bucket: s.S3Bucket,
-			Key:    obj.Key,
-		})
-		if err != nil {
-			return err
+	if aws.Int64Value(head.ContentLength) > maxCopyObjectSize {
+		return s.multipartCopy(ctx, head, key, key)
+	}
+
+	// при REPLACE заменяются и системные метаданные, а класс хранения и шифрование при копировании
+	// не наследуются, поэтому они копируются из исходного объекта. Теги копируются (TaggingDirective COPY)
+	_, err = s.client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:                  s.S3Bucket,
+		Key:                     aws.String(key),
+		CopySource:              s.copySource(key),
+		CopySourceIfMatch:       head.ETag,
+		MetadataDirective:       aws.String(s3.MetadataDirectiveReplace),
+		TaggingDirective:        aws.String(s3.TaggingDirectiveCopy),
+		Metadata:                head.Metadata,
+		CacheControl:            head.CacheControl,
+		ContentDisposition:      head.ContentDisposition,
+		ContentEncoding:         head.ContentEncoding,
+		ContentLanguage:         head.ContentLanguage,
+		ContentType:             head.ContentType,
+		Expires:                 s3Expires(head),
+		WebsiteRedirectLocation: head.WebsiteRedirectLocation,
+		StorageClass:            head.StorageClass,
+		ServerSideEncryption:    head.ServerSideEncryption,
+		SSEKMSKeyId:             head.SSEKMSKeyId,
+		BucketKeyEnabled:        head.BucketKeyEnabled,
+	})
+
+	return mapError(err)
+}
+
+// UpdateMeta - см. UpdateMetaCtx
+func (s *S3) UpdateMeta(path string, set map[string]string, unset []string) error {
+	return s.UpdateMetaCtx(context.Background(), path, set, unset)
+}
+
+// ClearDirCtx - удаляет все объекты внутри директории, маркер самой директории сохраняется.
+// Ключи перебираются по всем страницам ListObjectsV2 и удаляются пакетами DeleteObjects
+// не больше чем по 1000 ключей, одновременно выполняется не больше S3Concurrency пакетов.
+// Ошибки отдельных ключей не прерывают удаление и возвращаются вместе через errors.Join
+// ctx - контекст
+// path - путь к директории, корень хранилища (бакет или S3Prefix) - "."
+// Для пустого пути возвращается ErrNotExist, как в Local
+func (s *S3) ClearDirCtx(ctx context.Context, path string) error {
+	if path == "" {
+		return emptyPathError("open")
+	}
+	key, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+	// без "/" ClearDir("logs") удалил бы и "logs-archive/"
+	prefix := dirPrefix(key)
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	batches := make(chan []*s3.ObjectIdentifier)
+	for i := 0; i < s.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				if err := s.deleteBatch(ctx, batch); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	var batch []*s3.ObjectIdentifier
+	err = s.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: s.S3Bucket,
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			if aws.StringValue(obj.Key) == prefix {
+				// маркер самой директории
+				continue
+			}
+			batch = append(batch, &s3.ObjectIdentifier{Key: obj.Key})
+			if len(batch) == deleteBatchSize {
+				batches <- batch
+				batch = nil
+			}
 		}
+		return true
+	})
+	if len(batch) > 0 {
+		batches <- batch
 	}
+	close(batches)
+	wg.Wait()
 
-	return nil
+	if err != nil {
+		errs = append([]error{mapError(err)}, errs...)
+	}
+	return errors.Join(errs...)
 }
 
-// MkdirAll - создает директорию
+// deleteBatch - удаляет ключи одним запросом DeleteObjects.
+// Ошибки отдельных ключей объединяются через errors.Join и сопоставляются с ошибками пакета
+func (s *S3) deleteBatch(ctx context.Context, keys []*s3.ObjectIdentifier) error {
+	out, err := s.client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket: s.S3Bucket,
+		Delete: &s3.Delete{
+			Objects: keys,
+			Quiet:   aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	errs := make([]error, 0, len(out.Errors))
+	for _, e := range out.Errors {
+		keyErr := awserr.New(aws.StringValue(e.Code), aws.StringValue(e.Message), nil)
+		errs = append(errs, mapError(fmt.Errorf("delete %s: %w", aws.StringValue(e.Key), keyErr)))
+	}
+	return errors.Join(errs...)
+}
+
+// ClearDir - см. ClearDirCtx
+func (s *S3) ClearDir(path string) error {
+	return s.ClearDirCtx(context.Background(), path)
+}
+
+// MkdirAllCtx - создает директорию
+// ctx - контекст
 // path - путь к директории
-func (s *S3) MkdirAll(path string) error {
-	_, err := s.client.PutObject(&s3.PutObjectInput{
+// В S3 нет директорий, поэтому создается пустой объект-маркер с ключом, оканчивающимся на "/"
+func (s *S3) MkdirAllCtx(ctx context.Context, path string) error {
+	key, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
 		Bucket: s.S3Bucket,
-		Key:    aws.String(path),
+		Key:    aws.String(dirPrefix(key)),
 		Body:   bytes.NewReader([]byte("")),
 	})
 
-	return err
+	return mapError(err)
+}
+
+// MkdirAll - см. MkdirAllCtx
+func (s *S3) MkdirAll(path string) error {
+	return s.MkdirAllCtx(context.Background(), path)
+}
+
+// ReadDirCtx - возвращает содержимое директории
+// ctx - контекст
+// path - путь к директории
+// Вложенные директории определяются по общим префиксам ключей с разделителем "/"
+func (s *S3) ReadDirCtx(ctx context.Context, path string) ([]os.FileInfo, error) {
+	key, err := s.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := dirPrefix(key)
+
+	var files []os.FileInfo
+	err = s.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:    s.S3Bucket,
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, p := range page.CommonPrefixes {
+			files = append(files, &File{
+				name:  strings.TrimSuffix(strings.TrimPrefix(*p.Prefix, prefix), "/"),
+				isdir: true,
+			})
+		}
+		for _, obj := range page.Contents {
+			name := strings.TrimPrefix(*obj.Key, prefix)
+			if name == "" {
+				// маркер самой директории
+				continue
+			}
+			files = append(files, &File{
+				name:     name,
+				size:     aws.Int64Value(obj.Size),
+				modified: aws.TimeValue(obj.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+
+	return files, nil
+}
+
+// ReadDir - см. ReadDirCtx
+func (s *S3) ReadDir(path string) ([]os.FileInfo, error) {
+	return s.ReadDirCtx(context.Background(), path)
+}
+
+// WalkCtx - рекурсивно обходит директорию
+// ctx - контекст, при отмене которого обход прерывается
+// path - путь к директории, корень хранилища (бакет или S3Prefix) - "."
+// fn - функция, вызываемая для каждого файла и директории
+func (s *S3) WalkCtx(ctx context.Context, path string, fn filepath.WalkFunc) error {
+	key, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+	readDir := func(path string) ([]os.FileInfo, error) {
+		return s.ReadDirCtx(ctx, path)
+	}
+
+	// путь к объекту обходится как единственный файл, корень и путь с "/" в конце - всегда директории
+	if !isRoot(cleanPath(path)) && !strings.HasSuffix(key, "/") {
+		if info, _, err := s.StatCtx(ctx, path); err == nil {
+			return walk(ctx, path, info, readDir, fn)
+		}
+	}
+
+	root := &File{name: pathpkg.Base(cleanPath(path)), isdir: true}
+	return walk(ctx, path, root, readDir, fn)
+}
+
+// Walk - см. WalkCtx
+func (s *S3) Walk(path string, fn filepath.WalkFunc) error {
+	return s.WalkCtx(context.Background(), path, fn)
+}
+
+// CopyCtx - копирует объект на стороне сервера вместе с метаданными.
+// Объекты больше maxCopyObjectSize копируются по частям через UploadPartCopy
+// ctx - контекст
+// src - путь к исходному файлу
+// dst - путь к новому файлу
+func (s *S3) CopyCtx(ctx context.Context, src, dst string) error {
+	src, err := s.resolve(src)
+	if err != nil {
+		return err
+	}
+	dst, err = s.resolve(dst)
+	if err != nil {
+		return err
+	}
+
+	head, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: s.S3Bucket,
+		Key:    aws.String(src),
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	if aws.Int64Value(head.ContentLength) > maxCopyObjectSize {
+		return s.multipartCopy(ctx, head, src, dst)
+	}
+
+	_, err = s.client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     s.S3Bucket,
+		Key:        aws.String(dst),
+		CopySource: s.copySource(src),
+	})
+
+	return mapError(err)
+}
+
+// Copy - см. CopyCtx
+func (s *S3) Copy(src, dst string) error {
+	return s.CopyCtx(context.Background(), src, dst)
+}
+
+// MoveCtx - перемещает объект: копирует его на стороне сервера и удаляет исходный
+// ctx - контекст
+// src - путь к исходному файлу
+// dst - путь к новому файлу
+func (s *S3) MoveCtx(ctx context.Context, src, dst string) error {
+	if err := s.CopyCtx(ctx, src, dst); err != nil {
+		return err
+	}
+	return s.RemoveFileCtx(ctx, src)
 }
 
-// CreateJsonFile - создает json файл
+// Move - см. MoveCtx
+func (s *S3) Move(src, dst string) error {
+	return s.MoveCtx(context.Background(), src, dst)
+}
+
+// CreateJsonFileCtx - создает json файл
+// ctx - контекст
 // path - путь к файлу
 // data - данные для записи
-func (s *S3) CreateJsonFile(path string, data interface{}, meta map[string]string) error {
+func (s *S3) CreateJsonFileCtx(ctx context.Context, path string, data interface{}, meta map[string]string) error {
 	content, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
 		return err
 	}
-	return s.CreateFile(path, content, meta)
+	return s.CreateFileCtx(ctx, path, content, meta)
+}
+
+// CreateJsonFile - см. CreateJsonFileCtx
+func (s *S3) CreateJsonFile(path string, data interface{}, meta map[string]string) error {
+	return s.CreateJsonFileCtx(context.Background(), path, data, meta)
 }
 
-// GetJsonFile - получает файл и десериализует его в переменную
+// GetJsonFileCtx - получает файл и десериализует его в переменную
+// ctx - контекст
 // path - путь к файлу
 // file - переменная для записи данных
-func (s *S3) GetJsonFile(path string, file interface{}) error {
-	content, err := s.GetFile(path)
+// Если файл не существует, возвращается ErrNotExist. Если файл пуст, file не изменяется и ошибка не возвращается
+func (s *S3) GetJsonFileCtx(ctx context.Context, path string, file interface{}) error {
+	content, err := s.GetFileCtx(ctx, path)
 	if err != nil {
 		return err
 	}
-	if content == nil {
+	if len(content) == 0 {
 		return nil
 	}
 	return json.Unmarshal(content, file)
 }
 
+// GetJsonFile - см. GetJsonFileCtx
+func (s *S3) GetJsonFile(path string, file interface{}) error {
+	return s.GetJsonFileCtx(context.Background(), path, file)
+}
+
+// abortMultipartUpload - отменяет multipart upload.
+// Выполняется без контекста вызывающего, т.к. он может быть уже отменен
 func (s *S3) abortMultipartUpload(resp *s3.CreateMultipartUploadOutput) error {
 	abortInput := &s3.AbortMultipartUploadInput{
 		Bucket:   resp.Bucket,
@@ -312,7 +879,7 @@ func (s *S3) abortMultipartUpload(resp *s3.CreateMultipartUploadOutput) error {
 	return err
 }
 
-func (s *S3) completeMultipartUpload(resp *s3.CreateMultipartUploadOutput, completedParts []*s3.CompletedPart) (*s3.CompleteMultipartUploadOutput, error) {
+func (s *S3) completeMultipartUpload(ctx context.Context, resp *s3.CreateMultipartUploadOutput, completedParts []*s3.CompletedPart) (*s3.CompleteMultipartUploadOutput, error) {
 	completeInput := &s3.CompleteMultipartUploadInput{
 		Bucket:   s.S3Bucket,
 		Key:      resp.Key,
@@ -321,5 +888,266 @@ func (s *S3) completeMultipartUpload(resp *s3.CreateMultipartUploadOutput, compl
 			Parts: completedParts,
 		},
 	}
-	return s.client.CompleteMultipartUpload(completeInput)
+	return s.client.CompleteMultipartUploadWithContext(ctx, completeInput)
+}
+
+// dirPrefix - возвращает префикс ключей для директории
+// path - путь к директории
+func dirPrefix(path string) string {
+	path = strings.TrimSuffix(path, "/")
+	if path == "" || path == "." {
+		return ""
+	}
+	return path + "/"
+}
+
+// multipartCopy - копирует объект по частям через UploadPartCopy.
+// Используется для объектов больше 5GB, которые нельзя скопировать одним CopyObject.
+// Каждая часть копируется с условием CopySourceIfMatch по ETag из head, поэтому если исходный объект
+// изменился во время копирования, загрузка отменяется и возвращается ErrExist
+func (s *S3) multipartCopy(ctx context.Context, head *s3.HeadObjectOutput, src, dst string) error {
+	size := aws.Int64Value(head.ContentLength)
+
+	partSize := copyPartSize
+	if minSize := (size + maxPartsCount - 1) / maxPartsCount; partSize < minSize {
+		partSize = minSize
+	}
+
+	tags, err := s.client.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket: s.S3Bucket,
+		Key:    aws.String(src),
+	})
+	if err != nil {
+		return mapError(err)
+	}
+	var tagging *string
+	if len(tags.TagSet) > 0 {
+		values := url.Values{}
+		for _, tag := range tags.TagSet {
+			values.Add(aws.StringValue(tag.Key), aws.StringValue(tag.Value))
+		}
+		tagging = aws.String(values.Encode())
+	}
+
+	// UploadPartCopy копирует только данные, поэтому метаданные, класс хранения, шифрование и теги
+	// берутся из исходного объекта
+	resp, err := s.client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:                  s.S3Bucket,
+		Key:                     aws.String(dst),
+		Metadata:                head.Metadata,
+		CacheControl:            head.CacheControl,
+		ContentDisposition:      head.ContentDisposition,
+		ContentEncoding:         head.ContentEncoding,
+		ContentLanguage:         head.ContentLanguage,
+		ContentType:             head.ContentType,
+		Expires:                 s3Expires(head),
+		WebsiteRedirectLocation: head.WebsiteRedirectLocation,
+		StorageClass:            head.StorageClass,
+		ServerSideEncryption:    head.ServerSideEncryption,
+		SSEKMSKeyId:             head.SSEKMSKeyId,
+		BucketKeyEnabled:        head.BucketKeyEnabled,
+		Tagging:                 tagging,
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	var completedParts []*s3.CompletedPart
+	var partNumber int64 = 1
+
+	for offset := int64(0); offset < size; offset += partSize {
+		end := offset + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+
+		part, err := s.client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:            s.S3Bucket,
+			Key:               aws.String(dst),
+			UploadId:          resp.UploadId,
+			PartNumber:        aws.Int64(partNumber),
+			CopySource:        s.copySource(src),
+			CopySourceIfMatch: head.ETag,
+			CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+		})
+		if err != nil {
+			if abortErr := s.abortMultipartUpload(resp); abortErr != nil {
+				return mapError(abortErr)
+			}
+			return mapError(err)
+		}
+
+		completedParts = append(completedParts, &s3.CompletedPart{
+			ETag:       part.CopyPartResult.ETag,
+			PartNumber: aws.Int64(partNumber),
+		})
+
+		partNumber++
+	}
+
+	_, err = s.completeMultipartUpload(ctx, resp, completedParts)
+
+	return mapError(err)
+}
+
+// s3Expires - возвращает заголовок Expires объекта для копирования, некорректная дата пропускается
+func s3Expires(head *s3.HeadObjectOutput) *time.Time {
+	if head.Expires == nil {
+		return nil
+	}
+	expires, err := http.ParseTime(*head.Expires)
+	if err != nil {
+		return nil
+	}
+	return &expires
+}
+
+// copySource - возвращает значение x-amz-copy-source для объекта бакета
+// key - ключ объекта
+func (s *S3) copySource(key string) *string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return aws.String(strings.TrimPrefix(*s.S3Bucket, "/") + "/" + strings.Join(segments, "/"))
+}
+
+// streamSize - возвращает оставшийся размер потока, если его можно узнать без чтения
+func streamSize(stream io.Reader) (int64, bool) {
+	switch r := stream.(type) {
+	case interface{ Len() int }:
+		return int64(r.Len()), true
+	case io.Seeker:
+		cur, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		end, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, false
+		}
+		if _, err := r.Seek(cur, io.SeekStart); err != nil {
+			return 0, false
+		}
+		return end - cur, true
+	}
+	return 0, false
+}
+
+// partSizer - определяет размер очередной части multipart upload
+type partSizer struct {
+	base int64
+	grow bool
+}
+
+// newPartSizer - для потока известного размера увеличивает размер части так, чтобы уложиться в maxPartsCount,
+// для потока неизвестного размера включает удвоение размера части каждые partsPerGrowth частей
+// partSize - размер части из настроек
+// size - размер потока
+// sized - известен ли размер потока
+func newPartSizer(partSize, size int64, sized bool) partSizer {
+	if !sized {
+		return partSizer{base: partSize, grow: true}
+	}
+	if minSize := (size + maxPartsCount - 1) / maxPartsCount; minSize > partSize {
+		partSize = minSize
+	}
+	return partSizer{base: partSize}
+}
+
+func (p partSizer) size(partNumber int64) int64 {
+	size := p.base
+	if p.grow {
+		for i := int64(0); i < (partNumber-1)/partsPerGrowth && size < maxPartSize; i++ {
+			size *= 2
+		}
+	}
+	if size > maxPartSize {
+		size = maxPartSize
+	}
+	return size
+}
+
+// memoryBudget - ограничивает суммарный размер буферов частей, находящихся в памяти.
+// Одна часть выделяется всегда, даже если она больше бюджета
+type memoryBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	b := &memoryBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire - резервирует n байт, ожидая освобождения памяти другими частями
+func (b *memoryBudget) acquire(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.used > 0 && b.used+n > b.limit {
+		b.cond.Wait()
+	}
+	b.used += n
+}
+
+// release - освобождает n байт
+func (b *memoryBudget) release(n int64) {
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// PresignGet - возвращает ссылку GetObject, подписанную AWS Signature V4
+// path - путь к файлу
+// ttl - срок действия ссылки, не больше 7 дней
+func (s *S3) PresignGet(path string, ttl time.Duration) (string, error) {
+	key, err := s.resolve(path)
+	if err != nil {
+		return "", err
+	}
+
+	req, _ := s.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: s.S3Bucket,
+		Key:    aws.String(key),
+	})
+	return req.Presign(ttl)
+}
+
+// PresignPut - возвращает ссылку PutObject, подписанную AWS Signature V4.
+// Метаданные подписываются как заголовки x-amz-meta-*, которые клиент должен передать вместе с запросом
+// path - путь к файлу
+// ttl - срок действия ссылки, не больше 7 дней
+// meta - метаданные файла
+func (s *S3) PresignPut(path string, ttl time.Duration, meta map[string]string) (string, http.Header, error) {
+	key, err := s.resolve(path)
+	if err != nil {
+		return "", nil, err
+	}
+	meta, err = normalizeMeta(meta)
+	if err != nil {
+		return "", nil, err
+	}
+
+	req, _ := s.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:   s.S3Bucket,
+		Key:      aws.String(key),
+		Metadata: s3MetaInput(meta),
+	})
+	presigned, signed, err := req.PresignRequest(ttl)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// aws-sdk-go возвращает имена заголовков в нижнем регистре, http.Header.Get их не находит
+	header := make(http.Header, len(signed))
+	for name, values := range signed {
+		for _, value := range values {
+			header.Add(name, value)
+		}
+	}
+	return presigned, header, nil
 }
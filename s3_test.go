@@ -0,0 +1,926 @@
+package store_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/vlkalashnikov/go-store"
+	"github.com/vlkalashnikov/go-store/storetest"
+)
+
+func TestS3(t *testing.T) {
+	storetest.RunConformance(t, func(t *testing.T) store.StoreIFace {
+		return newS3(t, newFakeS3(t), store.S3Config{})
+	})
+}
+
+func TestS3Prefix(t *testing.T) {
+	storetest.RunConformance(t, func(t *testing.T) store.StoreIFace {
+		return newS3(t, newFakeS3(t), store.S3Config{S3Prefix: "tenant/a"})
+	})
+}
+
+// TestS3PrefixIsolation - проверяет, что хранилище с префиксом не затрагивает соседние ключи
+func TestS3PrefixIsolation(t *testing.T) {
+	srv := newFakeS3(t)
+	bucket := newS3(t, srv, store.S3Config{})
+	s := newS3(t, srv, store.S3Config{S3Prefix: "/tenant/a/"})
+
+	for _, key := range []string{"tenant/a-archive/file.txt", "tenant/b/file.txt", "file.txt"} {
+		if err := bucket.CreateFile(key, []byte("neighbour"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.CreateFile("dir/file.txt", []byte("inside"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bucket.IsExist("tenant/a/dir/file.txt") {
+		t.Fatal("object is not stored under prefix")
+	}
+
+	for _, p := range []string{"../b/file.txt", "dir/../../b/file.txt", "/file.txt"} {
+		if _, err := s.GetFile(p); !errors.Is(err, store.ErrOutsideRoot) {
+			t.Errorf("GetFile(%q) error = %v, want ErrOutsideRoot", p, err)
+		}
+	}
+
+	if err := s.ClearDir("."); err != nil {
+		t.Fatalf("ClearDir: %v", err)
+	}
+	if s.IsExist("dir/file.txt") {
+		t.Error("ClearDir did not remove object under prefix")
+	}
+	for _, key := range []string{"tenant/a-archive/file.txt", "tenant/b/file.txt", "file.txt"} {
+		if !bucket.IsExist(key) {
+			t.Errorf("ClearDir removed %q outside of prefix", key)
+		}
+	}
+}
+
+// newS3 - возвращает хранилище, подключенное к srv
+func newS3(t *testing.T, srv *fakeS3, cfg store.S3Config) store.StoreIFace {
+	t.Helper()
+	cfg.S3Bucket = fakeBucket
+	cfg.Config = aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(srv.URL),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		S3ForcePathStyle: aws.Bool(true),
+		DisableSSL:       aws.Bool(true),
+	}
+	s, err := store.NewS3(cfg)
+	if err != nil {
+		t.Fatalf("NewS3: %v", err)
+	}
+	return s
+}
+
+const (
+	fakeBucket      = "bucket"
+	fakeMinPartSize = 5 * 1024 * 1024
+)
+
+// fakeS3 - минимальная замена S3 для тестов: path-style адресация одного бакета,
+// объекты с метаданными, Range, ListObjectsV2 с постраничной выдачей, копирование и multipart upload
+type fakeS3 struct {
+	*httptest.Server
+
+	// PageSize - количество ключей на странице ListObjectsV2
+	PageSize int
+	// MaxPartsInFlight - наибольшее количество одновременных запросов UploadPart
+	MaxPartsInFlight atomic.Int32
+	// MaxDeleteBatch - наибольшее количество ключей в одном запросе DeleteObjects
+	MaxDeleteBatch int
+	// DenyDelete - префикс ключей, удаление которых через DeleteObjects завершается ошибкой AccessDenied
+	DenyDelete string
+	// DenyPart - номер части, загрузка которой через UploadPart завершается ошибкой AccessDenied
+	DenyPart int64
+	// OnCopyPart - вызывается под блокировкой перед копированием части через UploadPartCopy
+	OnCopyPart func(number int64)
+
+	partsInFlight atomic.Int32
+
+	mu      sync.Mutex
+	objects map[string]*fakeObject
+	uploads map[string]*fakeUpload
+	nextID  int
+}
+
+type fakeUpload struct {
+	meta    map[string]string
+	headers http.Header
+	tags    string
+	parts   map[int64][]byte
+}
+
+type fakeObject struct {
+	data     []byte
+	meta     map[string]string
+	headers  http.Header
+	tags     string
+	modified time.Time
+}
+
+// fakeContentHeaders - системные заголовки, которые CopyObject копирует из исходного объекта без REPLACE
+var fakeContentHeaders = []string{"Content-Type", "Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language", "Expires"}
+
+// fakeObjectHeaders - заголовки, которые CopyObject не копирует из исходного объекта
+var fakeObjectHeaders = []string{
+	"X-Amz-Website-Redirect-Location", "X-Amz-Storage-Class",
+	"X-Amz-Server-Side-Encryption", "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id",
+}
+
+// requestHeaders - возвращает заголовки names запроса r, которые хранятся вместе с объектом
+func requestHeaders(r *http.Request, names ...[]string) http.Header {
+	headers := http.Header{}
+	for _, list := range names {
+		for _, name := range list {
+			if v := r.Header.Get(name); v != "" {
+				headers.Set(name, v)
+			}
+		}
+	}
+	return headers
+}
+
+func (o *fakeObject) etag() string {
+	sum := md5.Sum(o.data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	f := &fakeS3{
+		PageSize: 1000,
+		objects:  make(map[string]*fakeObject),
+		uploads:  make(map[string]*fakeUpload),
+	}
+	f.Server = httptest.NewServer(f)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut && r.URL.Query().Has("partNumber") {
+		n := f.partsInFlight.Add(1)
+		defer f.partsInFlight.Add(-1)
+		for max := f.MaxPartsInFlight.Load(); n > max && !f.MaxPartsInFlight.CompareAndSwap(max, n); {
+			max = f.MaxPartsInFlight.Load()
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(p, "/")
+	if bucket != fakeBucket {
+		f.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	q := r.URL.Query()
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, q)
+	case key == "" && r.Method == http.MethodPost && q.Has("delete"):
+		f.deleteObjects(w, r)
+	case r.Method == http.MethodGet && q.Has("tagging"):
+		f.tagging(w, key)
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		f.createUpload(w, r, key)
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		f.uploadPart(w, r, q)
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		f.completeUpload(w, r, key, q.Get("uploadId"))
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		delete(f.uploads, q.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		f.copyObject(w, r, key)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = &fakeObject{
+			data:     data,
+			meta:     requestMeta(r),
+			headers:  requestHeaders(r, fakeContentHeaders, fakeObjectHeaders),
+			tags:     r.Header.Get("X-Amz-Tagging"),
+			modified: time.Now(),
+		}
+		w.Header().Set("ETag", f.objects[key].etag())
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		f.get(w, r, key)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// put - добавляет объект напрямую, без запроса к серверу
+func (f *fakeS3) put(key string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[key] = &fakeObject{data: data, meta: map[string]string{}, modified: time.Now()}
+}
+
+func (f *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (f *fakeS3) xml(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(v)
+}
+
+func requestMeta(r *http.Request) map[string]string {
+	meta := make(map[string]string)
+	for name, values := range r.Header {
+		if strings.HasPrefix(name, "X-Amz-Meta-") {
+			meta[strings.TrimPrefix(name, "X-Amz-Meta-")] = values[0]
+		}
+	}
+	return meta
+}
+
+func (f *fakeS3) get(w http.ResponseWriter, r *http.Request, key string) {
+	obj, ok := f.objects[key]
+	if !ok {
+		f.error(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	for k, v := range obj.meta {
+		w.Header().Set("X-Amz-Meta-"+k, v)
+	}
+	for k, v := range obj.headers {
+		w.Header()[k] = v
+	}
+	w.Header().Set("ETag", obj.etag())
+	w.Header().Set("Last-Modified", obj.modified.UTC().Format(http.TimeFormat))
+
+	data := obj.data
+	status := http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		start, end, ok := parseRange(rng, int64(len(data)))
+		if !ok {
+			f.error(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		data = data[start : end+1]
+		status = http.StatusPartialContent
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+// parseRange - разбирает заголовок вида "bytes=start-end" или "bytes=start-"
+func parseRange(rng string, size int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(rng, "bytes=")
+	if !ok {
+		return 0, 0, false
+	}
+	from, to, _ := strings.Cut(spec, "-")
+	start, err := strconv.ParseInt(from, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if to != "" {
+		if end, err = strconv.ParseInt(to, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
+
+// copySource - возвращает исходный объект копирования с учетом условия x-amz-copy-source-if-match.
+// Если источника нет или условие не выполнено, отвечает ошибкой и возвращает false
+func (f *fakeS3) copySource(w http.ResponseWriter, r *http.Request) (*fakeObject, bool) {
+	src, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		f.error(w, http.StatusBadRequest, "InvalidArgument")
+		return nil, false
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+	obj, ok := f.objects[key]
+	if !ok || bucket != fakeBucket {
+		f.error(w, http.StatusNotFound, "NoSuchKey")
+		return nil, false
+	}
+	if match := r.Header.Get("X-Amz-Copy-Source-If-Match"); match != "" && match != obj.etag() {
+		f.error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return nil, false
+	}
+	return obj, true
+}
+
+func (f *fakeS3) copyObject(w http.ResponseWriter, r *http.Request, key string) {
+	src, ok := f.copySource(w, r)
+	if !ok {
+		return
+	}
+
+	meta := src.meta
+	headers := requestHeaders(r, fakeObjectHeaders)
+	for _, name := range fakeContentHeaders {
+		if v := src.headers.Get(name); v != "" {
+			headers.Set(name, v)
+		}
+	}
+	if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		meta = requestMeta(r)
+		headers = requestHeaders(r, fakeContentHeaders, fakeObjectHeaders)
+	}
+	tags := src.tags
+	if r.Header.Get("X-Amz-Tagging-Directive") == "REPLACE" {
+		tags = r.Header.Get("X-Amz-Tagging")
+	}
+
+	obj := &fakeObject{data: src.data, meta: meta, headers: headers, tags: tags, modified: time.Now()}
+	f.objects[key] = obj
+	f.xml(w, struct {
+		XMLName xml.Name `xml:"CopyObjectResult"`
+		ETag    string
+	}{ETag: obj.etag()})
+}
+
+func (f *fakeS3) createUpload(w http.ResponseWriter, r *http.Request, key string) {
+	f.nextID++
+	id := strconv.Itoa(f.nextID)
+	f.uploads[id] = &fakeUpload{
+		meta:    requestMeta(r),
+		headers: requestHeaders(r, fakeContentHeaders, fakeObjectHeaders),
+		tags:    r.Header.Get("X-Amz-Tagging"),
+		parts:   make(map[int64][]byte),
+	}
+	f.xml(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string
+		Key      string
+		UploadId string
+	}{Bucket: fakeBucket, Key: key, UploadId: id})
+}
+
+func (f *fakeS3) uploadPart(w http.ResponseWriter, r *http.Request, q url.Values) {
+	upload, ok := f.uploads[q.Get("uploadId")]
+	if !ok {
+		f.error(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	parts := upload.parts
+	number, _ := strconv.ParseInt(q.Get("partNumber"), 10, 64)
+
+	if r.Header.Get("X-Amz-Copy-Source") == "" {
+		if number == f.DenyPart {
+			f.error(w, http.StatusForbidden, "AccessDenied")
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		parts[number] = data
+		w.Header().Set("ETag", (&fakeObject{data: data}).etag())
+		return
+	}
+
+	if f.OnCopyPart != nil {
+		f.OnCopyPart(number)
+	}
+	src, ok := f.copySource(w, r)
+	if !ok {
+		return
+	}
+	data := src.data
+	if rng := r.Header.Get("X-Amz-Copy-Source-Range"); rng != "" {
+		start, end, ok := parseRange(rng, int64(len(data)))
+		if !ok {
+			f.error(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return
+		}
+		data = data[start : end+1]
+	}
+	parts[number] = data
+	f.xml(w, struct {
+		XMLName xml.Name `xml:"CopyPartResult"`
+		ETag    string
+	}{ETag: (&fakeObject{data: data}).etag()})
+}
+
+func (f *fakeS3) completeUpload(w http.ResponseWriter, r *http.Request, key, id string) {
+	upload, ok := f.uploads[id]
+	if !ok {
+		f.error(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	var req struct {
+		Parts []struct {
+			PartNumber int64
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Parts) == 0 {
+		f.error(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	var data []byte
+	for i, part := range req.Parts {
+		chunk, ok := upload.parts[part.PartNumber]
+		if !ok {
+			f.error(w, http.StatusBadRequest, "InvalidPart")
+			return
+		}
+		if i > 0 && part.PartNumber <= req.Parts[i-1].PartNumber {
+			f.error(w, http.StatusBadRequest, "InvalidPartOrder")
+			return
+		}
+		if i < len(req.Parts)-1 && len(chunk) < fakeMinPartSize {
+			f.error(w, http.StatusBadRequest, "EntityTooSmall")
+			return
+		}
+		data = append(data, chunk...)
+	}
+
+	delete(f.uploads, id)
+	obj := &fakeObject{data: data, meta: upload.meta, headers: upload.headers, tags: upload.tags, modified: time.Now()}
+	f.objects[key] = obj
+	f.xml(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string
+		Key     string
+		ETag    string
+	}{Bucket: fakeBucket, Key: key, ETag: obj.etag()})
+}
+
+func (f *fakeS3) tagging(w http.ResponseWriter, key string) {
+	obj, ok := f.objects[key]
+	if !ok {
+		f.error(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	tags, _ := url.ParseQuery(obj.tags)
+
+	type tag struct {
+		Key   string
+		Value string
+	}
+	var result struct {
+		XMLName xml.Name `xml:"Tagging"`
+		Tags    []tag    `xml:"TagSet>Tag"`
+	}
+	for k, values := range tags {
+		for _, v := range values {
+			result.Tags = append(result.Tags, tag{k, v})
+		}
+	}
+	f.xml(w, result)
+}
+
+func (f *fakeS3) deleteObjects(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Objects []struct {
+			Key string
+		} `xml:"Object"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Objects) > 1000 {
+		f.error(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+	if len(req.Objects) > f.MaxDeleteBatch {
+		f.MaxDeleteBatch = len(req.Objects)
+	}
+
+	type deleted struct {
+		Key string
+	}
+	type deleteError struct {
+		Key     string
+		Code    string
+		Message string
+	}
+	var result struct {
+		XMLName xml.Name      `xml:"DeleteResult"`
+		Deleted []deleted     `xml:"Deleted"`
+		Errors  []deleteError `xml:"Error"`
+	}
+	for _, obj := range req.Objects {
+		if f.DenyDelete != "" && strings.HasPrefix(obj.Key, f.DenyDelete) {
+			result.Errors = append(result.Errors, deleteError{obj.Key, "AccessDenied", "Access Denied"})
+			continue
+		}
+		delete(f.objects, obj.Key)
+		result.Deleted = append(result.Deleted, deleted{obj.Key})
+	}
+	f.xml(w, result)
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, q url.Values) {
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+	}
+	type commonPrefix struct {
+		Prefix string
+	}
+	var result struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Name                  string
+		Prefix                string
+		KeyCount              int
+		IsTruncated           bool
+		NextContinuationToken string         `xml:",omitempty"`
+		Contents              []content      `xml:"Contents"`
+		CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+	}
+	result.Name, result.Prefix = fakeBucket, prefix
+
+	// commonPrefixOf - возвращает общий префикс ключа до разделителя или пустую строку
+	commonPrefixOf := func(key string) string {
+		if delimiter == "" || !strings.HasPrefix(key, prefix) {
+			return ""
+		}
+		if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+			return key[:len(prefix)+i+len(delimiter)]
+		}
+		return ""
+	}
+
+	seen := make(map[string]bool)
+	after := q.Get("continuation-token")
+	if p := commonPrefixOf(after); p != "" {
+		seen[p] = true
+	}
+	for _, key := range keys {
+		if key <= after {
+			continue
+		}
+		p := commonPrefixOf(key)
+		if p != "" && seen[p] {
+			continue
+		}
+		if result.KeyCount == f.PageSize {
+			result.IsTruncated = true
+			break
+		}
+		if p != "" {
+			seen[p] = true
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{p})
+			result.KeyCount++
+			result.NextContinuationToken = key
+			continue
+		}
+		obj := f.objects[key]
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			LastModified: obj.modified.UTC().Format(time.RFC3339),
+			ETag:         obj.etag(),
+			Size:         len(obj.data),
+		})
+		result.KeyCount++
+		result.NextContinuationToken = key
+	}
+	if !result.IsTruncated {
+		result.NextContinuationToken = ""
+	}
+
+	f.xml(w, result)
+}
+
+// TestFakeS3Pagination - проверяет, что ReadDir проходит по всем страницам ListObjectsV2
+func TestFakeS3Pagination(t *testing.T) {
+	srv := newFakeS3(t)
+	srv.PageSize = 3
+	s := newS3(t, srv, store.S3Config{})
+
+	for i := 0; i < 10; i++ {
+		if err := s.CreateFile(fmt.Sprintf("dir/%02d.txt", i), bytes.Repeat([]byte("x"), i), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	infos, err := s.ReadDir("dir")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(infos) != 10 {
+		t.Fatalf("ReadDir returned %d entries, want 10", len(infos))
+	}
+}
+
+// TestS3ClearDir - проверяет, что ClearDir удаляет ключи со всех страниц пакетами не больше 1000 ключей
+// и не затрагивает соседние ключи с тем же началом
+func TestS3ClearDir(t *testing.T) {
+	srv := newFakeS3(t)
+	srv.PageSize = 700
+	s := newS3(t, srv, store.S3Config{})
+
+	srv.put("logs/", nil)
+	for i := 0; i < 2500; i++ {
+		srv.put(fmt.Sprintf("logs/%04d.txt", i), []byte("x"))
+	}
+	srv.put("logs-archive/old.txt", []byte("x"))
+	srv.put("logs.txt", []byte("x"))
+
+	if err := s.ClearDir("logs"); err != nil {
+		t.Fatalf("ClearDir: %v", err)
+	}
+	if srv.MaxDeleteBatch > 1000 {
+		t.Errorf("DeleteObjects batch of %d keys, want at most 1000", srv.MaxDeleteBatch)
+	}
+	for _, key := range []string{"logs/", "logs-archive/old.txt", "logs.txt"} {
+		if _, ok := srv.objects[key]; !ok {
+			t.Errorf("ClearDir removed %q", key)
+		}
+	}
+	if len(srv.objects) != 3 {
+		t.Errorf("%d objects left, want 3", len(srv.objects))
+	}
+}
+
+// TestS3ClearDirErrors - проверяет, что ошибки отдельных ключей не прерывают удаление и возвращаются вместе
+func TestS3ClearDirErrors(t *testing.T) {
+	srv := newFakeS3(t)
+	srv.DenyDelete = "dir/locked"
+	s := newS3(t, srv, store.S3Config{})
+
+	for _, key := range []string{"dir/a.txt", "dir/locked-1.txt", "dir/locked-2.txt", "dir/z.txt"} {
+		srv.put(key, []byte("x"))
+	}
+
+	err := s.ClearDir("dir")
+	if !errors.Is(err, store.ErrPermission) {
+		t.Fatalf("ClearDir error = %v, want ErrPermission", err)
+	}
+	for _, key := range []string{"dir/locked-1.txt", "dir/locked-2.txt"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("ClearDir error %q does not mention %q", err, key)
+		}
+	}
+	if len(srv.objects) != 2 {
+		t.Errorf("%d objects left, want 2 locked objects", len(srv.objects))
+	}
+
+	if err := s.ClearDir("missing"); err != nil {
+		t.Errorf("ClearDir of empty prefix: %v", err)
+	}
+}
+
+// TestS3StreamShortReads - проверяет, что короткие чтения из потока не приводят к частям меньше 5MB
+func TestS3StreamShortReads(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), (2*fakeMinPartSize+12345)/16)
+
+	for name, wrap := range map[string]func(io.Reader) io.Reader{
+		"HalfReader":    iotest.HalfReader,
+		"DataErrReader": iotest.DataErrReader,
+		"Chunked": func(r io.Reader) io.Reader {
+			return io.MultiReader(io.LimitReader(r, 1024), io.LimitReader(r, fakeMinPartSize), r)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newS3(t, newFakeS3(t), store.S3Config{})
+			if err := s.StreamToFile(wrap(bytes.NewReader(data)), "file.bin"); err != nil {
+				t.Fatalf("StreamToFile: %v", err)
+			}
+			got, err := s.GetFile("file.bin")
+			if err != nil {
+				t.Fatalf("GetFile: %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("GetFile returned %d bytes, want %d", len(got), len(data))
+			}
+		})
+	}
+}
+
+// TestS3StreamConcurrency - проверяет, что части загружаются параллельно не более чем S3Concurrency запросами
+func TestS3StreamConcurrency(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 8*fakeMinPartSize+1)
+
+	for _, tc := range []struct {
+		cfg  store.S3Config
+		want int32
+	}{
+		{cfg: store.S3Config{S3Concurrency: 1}, want: 1},
+		{cfg: store.S3Config{S3Concurrency: 3}, want: 3},
+		// бюджет памяти ограничивает параллельность сильнее, чем S3Concurrency
+		{cfg: store.S3Config{S3Concurrency: 4, S3MemoryBudget: 2 * fakeMinPartSize}, want: 2},
+	} {
+		srv := newFakeS3(t)
+		s := newS3(t, srv, tc.cfg)
+		// io.MultiReader скрывает размер потока
+		if err := s.StreamToFile(io.MultiReader(bytes.NewReader(data)), "file.bin"); err != nil {
+			t.Fatalf("StreamToFile: %v", err)
+		}
+
+		if got := srv.MaxPartsInFlight.Load(); got > tc.want {
+			t.Errorf("%+v: %d parts uploaded concurrently, want at most %d", tc.cfg, got, tc.want)
+		}
+		if tc.want > 1 && srv.MaxPartsInFlight.Load() < 2 {
+			t.Errorf("%+v: parts were uploaded sequentially", tc.cfg)
+		}
+
+		got, err := s.GetFile("file.bin")
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("GetFile returned %d bytes, %v; want %d bytes", len(got), err, len(data))
+		}
+	}
+}
+
+// TestS3StreamStopsAfterPartError - проверяет, что после ошибки загрузки части следующая часть не читается из потока
+func TestS3StreamStopsAfterPartError(t *testing.T) {
+	srv := newFakeS3(t)
+	srv.DenyPart = 1
+	s := newS3(t, srv, store.S3Config{S3Concurrency: 1})
+
+	stream := &countingReader{r: io.MultiReader(bytes.NewReader(bytes.Repeat([]byte("x"), 8*fakeMinPartSize)))}
+	if err := s.StreamToFile(stream, "file.bin"); !errors.Is(err, store.ErrPermission) {
+		t.Fatalf("StreamToFile error = %v, want ErrPermission", err)
+	}
+	if stream.n > fakeMinPartSize {
+		t.Fatalf("read %d bytes from stream after part error, want at most %d", stream.n, fakeMinPartSize)
+	}
+}
+
+// countingReader - считает прочитанные из потока байты
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// TestS3UpdateMetaKeepsObject - UpdateMeta сохраняет системные заголовки, класс хранения, шифрование и теги,
+// в том числе когда объект копируется по частям
+func TestS3UpdateMetaKeepsObject(t *testing.T) {
+	for _, multipart := range []bool{false, true} {
+		t.Run(fmt.Sprint("multipart=", multipart), func(t *testing.T) {
+			if multipart {
+				t.Cleanup(store.SetS3CopyLimits(fakeMinPartSize, fakeMinPartSize))
+			}
+			srv := newFakeS3(t)
+			s := newS3(t, srv, store.S3Config{})
+
+			data := bytes.Repeat([]byte("x"), 2*fakeMinPartSize+1)
+			headers := http.Header{
+				"Content-Type":                                {"text/plain"},
+				"Cache-Control":                               {"no-cache"},
+				"Expires":                                     {"Wed, 21 Oct 2026 07:28:00 GMT"},
+				"X-Amz-Website-Redirect-Location":             {"/other"},
+				"X-Amz-Storage-Class":                         {"STANDARD_IA"},
+				"X-Amz-Server-Side-Encryption":                {"aws:kms"},
+				"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": {"key-1"},
+			}
+			srv.mu.Lock()
+			srv.objects["file.txt"] = &fakeObject{
+				data:     data,
+				meta:     map[string]string{"Author": "old"},
+				headers:  headers,
+				tags:     "env=prod&team=a",
+				modified: time.Now(),
+			}
+			srv.mu.Unlock()
+
+			if err := s.UpdateMeta("file.txt", map[string]string{"author": "new"}, nil); err != nil {
+				t.Fatalf("UpdateMeta: %v", err)
+			}
+
+			srv.mu.Lock()
+			obj := srv.objects["file.txt"]
+			srv.mu.Unlock()
+			if !bytes.Equal(obj.data, data) {
+				t.Fatal("UpdateMeta changed object data")
+			}
+			if obj.meta["Author"] != "new" {
+				t.Fatalf("meta = %v, want author=new", obj.meta)
+			}
+			if !reflect.DeepEqual(obj.headers, headers) {
+				t.Fatalf("headers = %v, want %v", obj.headers, headers)
+			}
+			tags, _ := url.ParseQuery(obj.tags)
+			if want := (url.Values{"env": {"prod"}, "team": {"a"}}); !reflect.DeepEqual(tags, want) {
+				t.Fatalf("tags = %v, want %v", tags, want)
+			}
+		})
+	}
+}
+
+// TestS3MultipartCopyIfMatch - если объект изменился во время копирования по частям,
+// копирование отменяется с ErrExist и не перезаписывает новый объект
+func TestS3MultipartCopyIfMatch(t *testing.T) {
+	t.Cleanup(store.SetS3CopyLimits(fakeMinPartSize, fakeMinPartSize))
+	srv := newFakeS3(t)
+	s := newS3(t, srv, store.S3Config{})
+
+	for _, op := range []struct {
+		name string
+		fn   func() error
+	}{
+		{"UpdateMeta", func() error { return s.UpdateMeta("file.txt", map[string]string{"author": "new"}, nil) }},
+		{"Copy", func() error { return s.Copy("file.txt", "copy.txt") }},
+	} {
+		if err := s.CreateFile("file.txt", bytes.Repeat([]byte("a"), 2*fakeMinPartSize+1), nil); err != nil {
+			t.Fatal(err)
+		}
+		changed := bytes.Repeat([]byte("b"), 2*fakeMinPartSize+1)
+		srv.OnCopyPart = func(number int64) {
+			if number == 2 {
+				srv.objects["file.txt"] = &fakeObject{data: changed, meta: map[string]string{}, modified: time.Now()}
+			}
+		}
+
+		if err := op.fn(); !errors.Is(err, store.ErrExist) {
+			t.Fatalf("%s error = %v, want ErrExist", op.name, err)
+		}
+		srv.OnCopyPart = nil
+
+		srv.mu.Lock()
+		obj, uploads := srv.objects["file.txt"], len(srv.uploads)
+		_, copied := srv.objects["copy.txt"]
+		srv.mu.Unlock()
+		if !bytes.Equal(obj.data, changed) || obj.meta["Author"] != "" {
+			t.Fatalf("%s overwrote the changed object", op.name)
+		}
+		if copied {
+			t.Fatalf("%s created copy from the changed object", op.name)
+		}
+		if uploads != 0 {
+			t.Fatalf("%s left %d multipart uploads", op.name, uploads)
+		}
+	}
+}
+
+// TestS3PrefixWalk - Walk разрешает путь внутри S3Prefix так же, как ReadDir
+func TestS3PrefixWalk(t *testing.T) {
+	srv := newFakeS3(t)
+	s := newS3(t, srv, store.S3Config{S3Prefix: "tenant/a"})
+	// объект с ключом, совпадающим с префиксом, не является корнем хранилища
+	srv.put("tenant/a", []byte("neighbour"))
+	srv.put("tenant/a/dir/file.txt", []byte("data"))
+
+	for _, root := range []string{".", ""} {
+		var got []string
+		err := s.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				got = append(got, path)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Walk(%q): %v", root, err)
+		}
+		if len(got) != 1 || !strings.HasSuffix(got[0], "dir/file.txt") {
+			t.Fatalf("Walk(%q) files = %v, want dir/file.txt", root, got)
+		}
+	}
+	if err := s.Walk("../b", func(string, os.FileInfo, error) error { return nil }); !errors.Is(err, store.ErrOutsideRoot) {
+		t.Fatalf("Walk outside prefix error = %v, want ErrOutsideRoot", err)
+	}
+}
@@ -0,0 +1,791 @@
+// Package storetest содержит набор тестов, который проверяет,
+// что реализация store.StoreIFace ведет себя так же, как остальные хранилища.
+//
+// Пример использования:
+//
+//	func TestMyStore(t *testing.T) {
+//		storetest.RunConformance(t, func(t *testing.T) store.StoreIFace {
+//			return newMyStore(t)
+//		})
+//	}
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/vlkalashnikov/go-store"
+)
+
+// Factory - создает новое пустое хранилище для одного теста
+type Factory func(t *testing.T) store.StoreIFace
+
+// RunConformance - запускает набор тестов для хранилища.
+// factory вызывается для каждого теста, тесты не должны видеть файлы друг друга
+func RunConformance(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.StoreIFace)
+	}{
+		{"CreateAndGetFile", testCreateAndGetFile},
+		{"EmptyFile", testEmptyFile},
+		{"Overwrite", testOverwrite},
+		{"NotExist", testNotExist},
+		{"GetFilePartially", testGetFilePartially},
+		{"InvalidRange", testInvalidRange},
+		{"FileReader", testFileReader},
+		{"FileReaderRange", testFileReaderRange},
+		{"FileReaderRandomAccess", testFileReaderRandomAccess},
+		{"StreamToFile", testStreamToFile},
+		{"StreamToFileEmpty", testStreamToFileEmpty},
+		{"StreamToFileWithMeta", testStreamToFileWithMeta},
+		{"Meta", testMeta},
+		{"MetaNormalize", testMetaNormalize},
+		{"MetaValues", testMetaValues},
+		{"GetMeta", testGetMeta},
+		{"UpdateMeta", testUpdateMeta},
+		{"Stat", testStat},
+		{"RemoveFile", testRemoveFile},
+		{"ClearDir", testClearDir},
+		{"RootPath", testRootPath},
+		{"MkdirAllAndReadDir", testMkdirAllAndReadDir},
+		{"Walk", testWalk},
+		{"ServiceSuffixes", testServiceSuffixes},
+		{"JsonFile", testJsonFile},
+		{"JsonFileNotExist", testJsonFileNotExist},
+		{"PutGetJSON", testPutGetJSON},
+		{"GetJSONNotExist", testGetJSONNotExist},
+		{"EncodeDecodeJSON", testEncodeDecodeJSON},
+		{"JSONLines", testJSONLines},
+		{"Copy", testCopy},
+		{"Move", testMove},
+		{"ContextCanceled", testContextCanceled},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, factory(t))
+		})
+	}
+}
+
+// content - возвращает детерминированное содержимое файла заданного размера
+func content(size int) []byte {
+	b := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(b)
+	return b
+}
+
+func mkdir(t *testing.T, s store.StoreIFace, dir string) {
+	t.Helper()
+	if err := s.MkdirAll(dir); err != nil {
+		t.Fatalf("MkdirAll(%q): %v", dir, err)
+	}
+}
+
+func create(t *testing.T, s store.StoreIFace, path string, data []byte, meta map[string]string) {
+	t.Helper()
+	if err := s.CreateFile(path, data, meta); err != nil {
+		t.Fatalf("CreateFile(%q): %v", path, err)
+	}
+}
+
+func expectFile(t *testing.T, s store.StoreIFace, path string, want []byte) {
+	t.Helper()
+	got, err := s.GetFile(path)
+	if err != nil {
+		t.Fatalf("GetFile(%q): %v", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("GetFile(%q) = %d bytes, want %d bytes", path, len(got), len(want))
+	}
+}
+
+func expectNotExist(t *testing.T, s store.StoreIFace, path string) {
+	t.Helper()
+	if s.IsExist(path) {
+		t.Fatalf("IsExist(%q) = true, want false", path)
+	}
+	if _, err := s.GetFile(path); !errors.Is(err, store.ErrNotExist) {
+		t.Fatalf("GetFile(%q) error = %v, want ErrNotExist", path, err)
+	}
+}
+
+func expectMeta(t *testing.T, s store.StoreIFace, path string, want map[string]string) {
+	t.Helper()
+	_, meta, err := s.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat(%q): %v", path, err)
+	}
+	if len(meta) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(meta, want) {
+		t.Fatalf("Stat(%q) meta = %v, want %v", path, meta, want)
+	}
+}
+
+func names(infos []os.FileInfo) []string {
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func testCreateAndGetFile(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	data := content(1024)
+	create(t, s, "dir/file.bin", data, nil)
+
+	if !s.IsExist("dir/file.bin") {
+		t.Fatal("IsExist = false, want true")
+	}
+	expectFile(t, s, "dir/file.bin", data)
+}
+
+func testEmptyFile(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	create(t, s, "dir/empty.txt", []byte{}, nil)
+
+	if !s.IsExist("dir/empty.txt") {
+		t.Fatal("IsExist of empty file = false, want true")
+	}
+	expectFile(t, s, "dir/empty.txt", []byte{})
+}
+
+func testOverwrite(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	create(t, s, "dir/file.txt", []byte("first version"), nil)
+	create(t, s, "dir/file.txt", []byte("second"), nil)
+
+	expectFile(t, s, "dir/file.txt", []byte("second"))
+}
+
+func testNotExist(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	expectNotExist(t, s, "dir/missing.txt")
+
+	if _, err := s.GetFilePartially("dir/missing.txt", 0, 10); !errors.Is(err, store.ErrNotExist) {
+		t.Fatalf("GetFilePartially error = %v, want ErrNotExist", err)
+	}
+	if _, err := s.FileReader("dir/missing.txt", 0, 0); !errors.Is(err, store.ErrNotExist) {
+		t.Fatalf("FileReader error = %v, want ErrNotExist", err)
+	}
+	if _, _, err := s.Stat("dir/missing.txt"); !errors.Is(err, store.ErrNotExist) {
+		t.Fatalf("Stat error = %v, want ErrNotExist", err)
+	}
+}
+
+func testGetFilePartially(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	create(t, s, "dir/file.txt", []byte("0123456789"), nil)
+
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, 10, "0123456789"},
+		{2, 3, "234"},
+		{5, -1, "56789"},
+		{5, 0, "56789"},
+		{8, 10, "89"},
+	}
+
+	for _, tt := range tests {
+		got, err := s.GetFilePartially("dir/file.txt", tt.offset, tt.length)
+		if err != nil {
+			t.Fatalf("GetFilePartially(%d, %d): %v", tt.offset, tt.length, err)
+		}
+		if string(got) != tt.want {
+			t.Fatalf("GetFilePartially(%d, %d) = %q, want %q", tt.offset, tt.length, got, tt.want)
+		}
+	}
+}
+
+func testInvalidRange(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	create(t, s, "dir/file.txt", []byte("0123456789"), nil)
+
+	if _, err := s.GetFilePartially("dir/file.txt", 20, 5); !errors.Is(err, store.ErrInvalidRange) {
+		t.Fatalf("GetFilePartially past EOF error = %v, want ErrInvalidRange", err)
+	}
+}
+
+func testFileReader(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	data := content(64 * 1024)
+	create(t, s, "dir/file.bin", data, nil)
+
+	r, err := s.FileReader("dir/file.bin", 0, 0)
+	if err != nil {
+		t.Fatalf("FileReader: %v", err)
+	}
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("FileReader returned %d bytes, want %d", len(got), len(data))
+	}
+}
+
+func readRange(t *testing.T, s store.StoreIFace, path string, offset, length int64) string {
+	t.Helper()
+	r, err := s.FileReader(path, offset, length)
+	if err != nil {
+		t.Fatalf("FileReader(%d, %d): %v", offset, length, err)
+	}
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("FileReader(%d, %d): ReadAll: %v", offset, length, err)
+	}
+	return string(got)
+}
+
+func testFileReaderRange(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	create(t, s, "dir/file.txt", []byte("0123456789"), nil)
+
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, 0, "0123456789"},
+		{2, 3, "234"},
+		{5, 0, "56789"},
+		{5, -1, "56789"},
+		{8, 10, "89"},
+	}
+
+	for _, tt := range tests {
+		if got := readRange(t, s, "dir/file.txt", tt.offset, tt.length); got != tt.want {
+			t.Fatalf("FileReader(%d, %d) = %q, want %q", tt.offset, tt.length, got, tt.want)
+		}
+	}
+
+	if _, err := s.FileReader("dir/file.txt", 20, 5); !errors.Is(err, store.ErrInvalidRange) {
+		t.Fatalf("FileReader past EOF error = %v, want ErrInvalidRange", err)
+	}
+}
+
+// testFileReaderRandomAccess - если хранилище поддерживает произвольный доступ,
+// io.ReaderAt и io.Seeker должны работать в пределах запрошенной части файла
+func testFileReaderRandomAccess(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	create(t, s, "dir/file.txt", []byte("0123456789"), nil)
+
+	r, err := s.FileReader("dir/file.txt", 2, 6)
+	if err != nil {
+		t.Fatalf("FileReader: %v", err)
+	}
+	defer r.Close()
+
+	if ra, ok := r.(io.ReaderAt); ok {
+		buf := make([]byte, 2)
+		if _, err := ra.ReadAt(buf, 3); err != nil || string(buf) != "56" {
+			t.Fatalf("ReadAt(3) = %q, %v, want \"56\"", buf, err)
+		}
+	}
+
+	if seeker, ok := r.(io.Seeker); ok {
+		if pos, err := seeker.Seek(-2, io.SeekEnd); err != nil || pos != 4 {
+			t.Fatalf("Seek(-2, SeekEnd) = %d, %v, want 4", pos, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || string(got) != "67" {
+			t.Fatalf("read after Seek = %q, %v, want \"67\"", got, err)
+		}
+	}
+}
+
+func testStreamToFile(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	// больше минимального размера части multipart upload в S3
+	data := content(6*1024*1024 + 123)
+
+	if err := s.StreamToFile(bytes.NewReader(data), "dir/stream.bin"); err != nil {
+		t.Fatalf("StreamToFile: %v", err)
+	}
+	expectFile(t, s, "dir/stream.bin", data)
+}
+
+func testStreamToFileEmpty(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+
+	if err := s.StreamToFile(bytes.NewReader(nil), "dir/empty.bin"); err != nil {
+		t.Fatalf("StreamToFile: %v", err)
+	}
+	if !s.IsExist("dir/empty.bin") {
+		t.Fatal("IsExist = false, want true")
+	}
+	expectFile(t, s, "dir/empty.bin", []byte{})
+}
+
+func testStreamToFileWithMeta(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	data := content(6*1024*1024 + 123)
+	meta := map[string]string{"author": "store", "version": "1"}
+
+	if err := s.StreamToFileWithMeta(bytes.NewReader(data), "dir/stream.bin", meta); err != nil {
+		t.Fatalf("StreamToFileWithMeta: %v", err)
+	}
+	expectFile(t, s, "dir/stream.bin", data)
+	expectMeta(t, s, "dir/stream.bin", meta)
+
+	if err := s.StreamToFileWithMeta(bytes.NewReader(nil), "dir/empty.bin", meta); err != nil {
+		t.Fatalf("StreamToFileWithMeta: %v", err)
+	}
+	expectFile(t, s, "dir/empty.bin", []byte{})
+	expectMeta(t, s, "dir/empty.bin", meta)
+}
+
+func testMeta(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	meta := map[string]string{"author": "store", "version": "1"}
+
+	create(t, s, "dir/with-meta.txt", []byte("data"), meta)
+	create(t, s, "dir/without-meta.txt", []byte("data"), nil)
+
+	expectMeta(t, s, "dir/with-meta.txt", meta)
+	expectMeta(t, s, "dir/without-meta.txt", nil)
+}
+
+// testMetaNormalize - ключи метаданных приводятся к нижнему регистру, как в S3
+func testMetaNormalize(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+
+	create(t, s, "dir/file.txt", []byte("data"), map[string]string{"Author": "store", "Content-Version": "1"})
+	expectMeta(t, s, "dir/file.txt", map[string]string{"author": "store", "content-version": "1"})
+
+	for _, meta := range []map[string]string{
+		{"bad key": "value"},
+		{"": "value"},
+		{"Author": "a", "author": "b"},
+		{"large": strings.Repeat("x", 2048)},
+	} {
+		if err := s.CreateFile("dir/invalid.txt", []byte("data"), meta); !errors.Is(err, store.ErrInvalidMeta) {
+			t.Errorf("CreateFile with meta %.40v error = %v, want ErrInvalidMeta", meta, err)
+		}
+	}
+}
+
+// testMetaValues - значения метаданных сохраняются без изменений
+func testMetaValues(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	meta := map[string]string{
+		"base64":  "aGVsbG8gd29ybGQ=",
+		"url":     "https://example.com/path?a=1&b=2",
+		"json":    `{"key": "value", "list": [1, 2]}`,
+		"newline": "first line\nsecond line",
+		"unicode": "Привет, 世界",
+		"empty":   "",
+		"encoded": "=?utf-8?q?hi?=",
+		"inner":   "a =?utf-8?q?hi?= b",
+		"padded":  " padded ",
+		"tab":     "\ttab",
+	}
+
+	create(t, s, "dir/file.txt", []byte("data"), meta)
+	expectMeta(t, s, "dir/file.txt", meta)
+}
+
+func testGetMeta(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	meta := map[string]string{"author": "store", "version": "1"}
+	create(t, s, "dir/file.txt", []byte("data"), meta)
+
+	got, err := s.GetMeta("dir/file.txt")
+	if err != nil {
+		t.Fatalf("GetMeta: %v", err)
+	}
+	if !reflect.DeepEqual(got, meta) {
+		t.Fatalf("GetMeta = %v, want %v", got, meta)
+	}
+
+	if _, err := s.GetMeta("dir/missing.txt"); !errors.Is(err, store.ErrNotExist) {
+		t.Fatalf("GetMeta(missing) error = %v, want ErrNotExist", err)
+	}
+}
+
+func testUpdateMeta(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	data := content(1024)
+	create(t, s, "dir/file.txt", data, map[string]string{"author": "store", "version": "1"})
+
+	err := s.UpdateMeta("dir/file.txt", map[string]string{"Version": "2", "url": "https://example.com/?a=1"}, []string{"Author"})
+	if err != nil {
+		t.Fatalf("UpdateMeta: %v", err)
+	}
+	expectMeta(t, s, "dir/file.txt", map[string]string{"version": "2", "url": "https://example.com/?a=1"})
+	expectFile(t, s, "dir/file.txt", data)
+
+	if err := s.UpdateMeta("dir/file.txt", nil, []string{"version", "url"}); err != nil {
+		t.Fatalf("UpdateMeta: %v", err)
+	}
+	expectMeta(t, s, "dir/file.txt", nil)
+
+	create(t, s, "dir/plain.txt", []byte("data"), nil)
+	if err := s.UpdateMeta("dir/plain.txt", map[string]string{"author": "store"}, nil); err != nil {
+		t.Fatalf("UpdateMeta: %v", err)
+	}
+	expectMeta(t, s, "dir/plain.txt", map[string]string{"author": "store"})
+
+	if err := s.UpdateMeta("dir/plain.txt", map[string]string{"bad key": "value"}, nil); !errors.Is(err, store.ErrInvalidMeta) {
+		t.Fatalf("UpdateMeta with invalid key error = %v, want ErrInvalidMeta", err)
+	}
+	if err := s.UpdateMeta("dir/missing.txt", map[string]string{"author": "store"}, nil); !errors.Is(err, store.ErrNotExist) {
+		t.Fatalf("UpdateMeta(missing) error = %v, want ErrNotExist", err)
+	}
+	expectNotExist(t, s, "dir/missing.txt")
+}
+
+func testStat(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	create(t, s, "dir/file.txt", []byte("0123456789"), nil)
+
+	info, _, err := s.Stat("dir/file.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Name() != "file.txt" {
+		t.Fatalf("Name = %q, want file.txt", info.Name())
+	}
+	if info.Size() != 10 {
+		t.Fatalf("Size = %d, want 10", info.Size())
+	}
+	if info.IsDir() {
+		t.Fatal("IsDir = true, want false")
+	}
+	if info.ModTime().IsZero() {
+		t.Fatal("ModTime is zero")
+	}
+}
+
+func testRemoveFile(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	create(t, s, "dir/file.txt", []byte("data"), map[string]string{"author": "store"})
+
+	if err := s.RemoveFile("dir/file.txt"); err != nil {
+		t.Fatalf("RemoveFile: %v", err)
+	}
+	expectNotExist(t, s, "dir/file.txt")
+
+	// метаданные удаляются вместе с файлом
+	create(t, s, "dir/file.txt", []byte("data"), nil)
+	expectMeta(t, s, "dir/file.txt", nil)
+}
+
+func testClearDir(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir/sub")
+	create(t, s, "dir/a.txt", []byte("a"), map[string]string{"author": "store"})
+	create(t, s, "dir/b.txt", []byte("b"), nil)
+	create(t, s, "dir/sub/c.txt", []byte("c"), nil)
+
+	if err := s.ClearDir("dir"); err != nil {
+		t.Fatalf("ClearDir: %v", err)
+	}
+
+	expectNotExist(t, s, "dir/a.txt")
+	expectNotExist(t, s, "dir/sub/c.txt")
+
+	infos, err := s.ReadDir("dir")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(infos) != 0 {
+		t.Fatalf("ReadDir after ClearDir = %v, want empty", names(infos))
+	}
+}
+
+// testRootPath - корень хранилища "." существует, а ClearDir с пустым путем ничего не удаляет
+func testRootPath(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	create(t, s, "dir/file.txt", []byte("data"), nil)
+
+	if !s.IsExist(".") {
+		t.Error(`IsExist(".") = false, want true`)
+	}
+	if err := s.ClearDir(""); !errors.Is(err, store.ErrNotExist) {
+		t.Fatalf(`ClearDir("") error = %v, want ErrNotExist`, err)
+	}
+	expectFile(t, s, "dir/file.txt", []byte("data"))
+}
+
+func testMkdirAllAndReadDir(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "a/b/c")
+	create(t, s, "a/file.txt", []byte("data"), map[string]string{"author": "store"})
+
+	for _, dir := range []string{"a", "a/b", "a/b/c"} {
+		if !s.IsExist(dir) {
+			t.Fatalf("IsExist(%q) = false, want true", dir)
+		}
+	}
+
+	infos, err := s.ReadDir("a")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+
+	got := names(infos)
+	want := []string{"b", "file.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ReadDir = %v, want %v", got, want)
+	}
+
+	for _, info := range infos {
+		if info.IsDir() != (info.Name() == "b") {
+			t.Fatalf("%s: IsDir = %v", info.Name(), info.IsDir())
+		}
+	}
+}
+
+func testWalk(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "root/sub")
+	create(t, s, "root/a.txt", []byte("a"), map[string]string{"author": "store"})
+	create(t, s, "root/sub/b.txt", []byte("b"), nil)
+
+	var got []string
+	err := s.Walk("root", func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		got = append(got, path.Clean(filepath.ToSlash(p)))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+
+	sort.Strings(got)
+	want := []string{"root", "root/a.txt", "root/sub", "root/sub/b.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Walk = %v, want %v", got, want)
+	}
+}
+
+// testServiceSuffixes - пользовательские файлы с суффиксами .meta и .tmp не скрываются как служебные
+func testServiceSuffixes(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	create(t, s, "dir/file.txt", []byte("data"), map[string]string{"author": "store"})
+	create(t, s, "dir/notes.meta", []byte("notes"), nil)
+	create(t, s, "dir/.draft.tmp", []byte("draft"), nil)
+
+	infos, err := s.ReadDir("dir")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	want := []string{".draft.tmp", "file.txt", "notes.meta"}
+	if got := names(infos); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ReadDir = %v, want %v", got, want)
+	}
+
+	var got []string
+	err = s.Walk("dir", func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			got = append(got, path.Base(filepath.ToSlash(p)))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Walk = %v, want %v", got, want)
+	}
+}
+
+type jsonDoc struct {
+	Name  string   `json:"name"`
+	Count int      `json:"count"`
+	Tags  []string `json:"tags"`
+}
+
+func testJsonFile(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	want := jsonDoc{Name: "doc", Count: 3, Tags: []string{"a", "b"}}
+
+	if err := s.CreateJsonFile("dir/doc.json", want, nil); err != nil {
+		t.Fatalf("CreateJsonFile: %v", err)
+	}
+
+	var got jsonDoc
+	if err := s.GetJsonFile("dir/doc.json", &got); err != nil {
+		t.Fatalf("GetJsonFile: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetJsonFile = %+v, want %+v", got, want)
+	}
+}
+
+func testJsonFileNotExist(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	got := jsonDoc{Name: "untouched"}
+
+	if err := s.GetJsonFile("dir/missing.json", &got); !errors.Is(err, store.ErrNotExist) {
+		t.Fatalf("GetJsonFile error = %v, want ErrNotExist", err)
+	}
+	if got.Name != "untouched" {
+		t.Fatalf("GetJsonFile changed target: %+v", got)
+	}
+}
+
+func testPutGetJSON(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	want := jsonDoc{Name: "doc", Count: 3, Tags: []string{"a", "b"}}
+
+	if err := store.PutJSON(s, "dir/doc.json", want, map[string]string{"author": "store"}); err != nil {
+		t.Fatalf("PutJSON: %v", err)
+	}
+	got, err := store.GetJSON[jsonDoc](s, "dir/doc.json")
+	if err != nil {
+		t.Fatalf("GetJSON: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetJSON = %+v, want %+v", got, want)
+	}
+	expectMeta(t, s, "dir/doc.json", map[string]string{"author": "store"})
+
+	if err := store.PutJSON(s, "dir/compact.json", want, nil, store.JSONCompact()); err != nil {
+		t.Fatalf("PutJSON compact: %v", err)
+	}
+	expectFile(t, s, "dir/compact.json", []byte(`{"name":"doc","count":3,"tags":["a","b"]}`))
+}
+
+func testGetJSONNotExist(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+
+	if _, err := store.GetJSON[jsonDoc](s, "dir/missing.json"); !errors.Is(err, store.ErrNotExist) {
+		t.Fatalf("GetJSON error = %v, want ErrNotExist", err)
+	}
+}
+
+func testEncodeDecodeJSON(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	want := jsonDoc{Name: "doc", Count: 3, Tags: []string{"a", "b"}}
+
+	if err := store.EncodeJSON(s, "dir/doc.json", want, map[string]string{"author": "store"}); err != nil {
+		t.Fatalf("EncodeJSON: %v", err)
+	}
+	got, err := store.DecodeJSON[jsonDoc](s, "dir/doc.json")
+	if err != nil {
+		t.Fatalf("DecodeJSON: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("DecodeJSON = %+v, want %+v", got, want)
+	}
+	expectMeta(t, s, "dir/doc.json", map[string]string{"author": "store"})
+
+	if err := store.EncodeJSON(s, "dir/bad.json", func() {}, nil); err == nil {
+		t.Fatal("EncodeJSON of unsupported value succeeded")
+	}
+	if _, err := store.DecodeJSON[jsonDoc](s, "dir/missing.json"); !errors.Is(err, store.ErrNotExist) {
+		t.Fatalf("DecodeJSON error = %v, want ErrNotExist", err)
+	}
+}
+
+func testJSONLines(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	const count = 1000
+
+	w := store.NewJSONLinesWriter(s, "dir/records.jsonl", map[string]string{"author": "store"})
+	for i := 0; i < count; i++ {
+		if err := w.Write(jsonDoc{Name: "record", Count: i}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	expectMeta(t, s, "dir/records.jsonl", map[string]string{"author": "store"})
+
+	r, err := store.OpenJSONLines[jsonDoc](s, "dir/records.jsonl")
+	if err != nil {
+		t.Fatalf("OpenJSONLines: %v", err)
+	}
+	defer r.Close()
+	n := 0
+	for r.Next() {
+		if got := r.Value(); got.Count != n {
+			t.Fatalf("record %d has count %d", n, got.Count)
+		}
+		n++
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if n != count {
+		t.Fatalf("read %d records, want %d", n, count)
+	}
+
+	content, err := s.GetFile("dir/records.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(content, []byte("\n")); lines != count {
+		t.Fatalf("file has %d lines, want %d", lines, count)
+	}
+}
+
+func testCopy(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	meta := map[string]string{"author": "store"}
+	create(t, s, "dir/src.txt", []byte("data"), meta)
+
+	if err := s.Copy("dir/src.txt", "dir/dst.txt"); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+
+	expectFile(t, s, "dir/src.txt", []byte("data"))
+	expectFile(t, s, "dir/dst.txt", []byte("data"))
+	expectMeta(t, s, "dir/dst.txt", meta)
+}
+
+func testMove(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	meta := map[string]string{"author": "store"}
+	create(t, s, "dir/src.txt", []byte("data"), meta)
+
+	if err := s.Move("dir/src.txt", "dir/dst.txt"); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+
+	expectNotExist(t, s, "dir/src.txt")
+	expectFile(t, s, "dir/dst.txt", []byte("data"))
+	expectMeta(t, s, "dir/dst.txt", meta)
+}
+
+func testContextCanceled(t *testing.T, s store.StoreIFace) {
+	mkdir(t, s, "dir")
+	create(t, s, "dir/file.txt", []byte("data"), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := s.GetFileCtx(ctx, "dir/file.txt"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetFileCtx error = %v, want context.Canceled", err)
+	}
+	if err := s.StreamToFileCtx(ctx, bytes.NewReader([]byte("data")), "dir/stream.txt"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("StreamToFileCtx error = %v, want context.Canceled", err)
+	}
+}
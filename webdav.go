@@ -2,69 +2,308 @@ package store
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"net/http"
 	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/studio-b12/gowebdav"
 )
 
 type WebDav struct {
 	client *gowebdav.Client
+	http   *http.Client
+	host   string
+	auth   gowebdav.Authorizer
+	root   string
+	atomic bool
+	props  bool
+
+	concurrency int
+	presign     PresignConfig
 }
 
 func (w *WebDav) init(cfg WebDavConfig) error {
-	w.client = gowebdav.NewClient(cfg.WebDavHost, cfg.WebDavUser, cfg.WebDavPass)
+	w.host = cfg.WebDavHost
+	w.auth = gowebdav.NewAutoAuth(cfg.WebDavUser, cfg.WebDavPass)
+	w.http = cfg.WebDavHTTPClient
+	if w.http == nil {
+		w.http = new(http.Client)
+	}
+	w.client = w.newClient(w.http.Transport)
+	w.root = cfg.WebDavRoot
+	w.atomic = cfg.WebDavAtomicWrites
+	w.props = cfg.WebDavPropMeta
+	w.concurrency = cfg.WebDavConcurrency
+	w.presign = cfg.PresignConfig
+	if w.concurrency <= 0 {
+		w.concurrency = defaultConcurrency
+	}
 	return nil
 }
 
-// IsExist - проверяет существование файла
+// resolve - возвращает путь к файлу на сервере внутри WebDavRoot.
+// Пути, выходящие за пределы корня, отклоняются
+// path - путь относительно корня хранилища
+func (w *WebDav) resolve(path string) (string, error) {
+	return joinRoot(w.root, path)
+}
+
+// newClient - возвращает клиент gowebdav с таймаутом и cookie WebDavHTTPClient и транспортом transport.
+// Клиент использует общий Authorizer, поэтому повторное согласование авторизации не требуется
+func (w *WebDav) newClient(transport http.RoundTripper) *gowebdav.Client {
+	c := gowebdav.NewAuthClient(w.host, w.auth)
+	if transport != nil {
+		c.SetTransport(transport)
+	}
+	c.SetTimeout(w.http.Timeout)
+	c.SetJar(w.http.Jar)
+	return c
+}
+
+// withContext - возвращает клиент, HTTP-запросы которого выполняются с контекстом ctx
+// через транспорт WebDavHTTPClient
+func (w *WebDav) withContext(ctx context.Context) *gowebdav.Client {
+	if ctx.Done() == nil {
+		return w.client
+	}
+	base := w.http.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return w.newClient(&ctxTransport{ctx: ctx, base: base})
+}
+
+// ctxTransport - http.RoundTripper, который привязывает запросы к контексту
+type ctxTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t *ctxTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(r.WithContext(t.ctx))
+}
+
+// IsExistCtx - проверяет существование файла, в том числе пустого
+// ctx - контекст
 // filePath - путь к файлу
+func (w *WebDav) IsExistCtx(ctx context.Context, filePath string) bool {
+	filePath, err := w.resolve(filePath)
+	if err != nil {
+		return false
+	}
+	_, err = w.withContext(ctx).Stat(filePath)
+	return err == nil
+}
+
+// IsExist - см. IsExistCtx
 func (w *WebDav) IsExist(filePath string) bool {
-	info, err := w.client.Stat(filePath)
-	return err == nil && info.Size() > 0
+	return w.IsExistCtx(context.Background(), filePath)
 }
 
-// CreateFile - создает файл
+// CreateFileCtx - создает файл
+// ctx - контекст
 // path - путь к файлу
 // file - содержимое файла
 // meta - метаданные файла
-func (w *WebDav) CreateFile(path string, file []byte, meta map[string]string) error {
-	if meta != nil {
-		if err := w.client.Write(path+META_PREFIX, meta2Bytes(meta), perm); err != nil {
-			return err
-		}
+func (w *WebDav) CreateFileCtx(ctx context.Context, path string, file []byte, meta map[string]string) error {
+	path, err := w.resolve(path)
+	if err != nil {
+		return err
 	}
+	meta, err = normalizeMeta(meta)
+	if err != nil {
+		return err
+	}
+
+	client := w.withContext(ctx)
+	return mapError(w.writeWithMeta(ctx, client, path, meta, func(path string) error {
+		return client.Write(path, file, perm)
+	}))
+}
 
-	return w.client.Write(path, file, perm)
+// CreateFile - см. CreateFileCtx
+func (w *WebDav) CreateFile(path string, file []byte, meta map[string]string) error {
+	return w.CreateFileCtx(context.Background(), path, file, meta)
 }
 
-// StreamToFile - записывает содержимое потока в файл
+// StreamToFileCtx - записывает содержимое потока в файл без изменения метаданных, см. StreamToFileWithMetaCtx
+// ctx - контекст
 // stream - поток
 // path - путь к файлу
+func (w *WebDav) StreamToFileCtx(ctx context.Context, stream io.Reader, path string) error {
+	return w.StreamToFileWithMetaCtx(ctx, stream, path, nil)
+}
+
+// StreamToFile - см. StreamToFileCtx
 func (w *WebDav) StreamToFile(stream io.Reader, path string) error {
-	return w.client.WriteStream(path, stream, perm)
+	return w.StreamToFileCtx(context.Background(), stream, path)
 }
 
-// GetFile - возвращает содержимое файла
+// StreamToFileWithMetaCtx - записывает содержимое потока в файл вместе с метаданными, см. writeWithMeta
+// ctx - контекст, при отмене которого запрос прерывается
+// stream - поток
 // path - путь к файлу
-func (w *WebDav) GetFile(path string) ([]byte, error) {
-	if !w.IsExist(path) {
-		return nil, nil
+// meta - метаданные файла
+func (w *WebDav) StreamToFileWithMetaCtx(ctx context.Context, stream io.Reader, path string, meta map[string]string) error {
+	path, err := w.resolve(path)
+	if err != nil {
+		return err
+	}
+	meta, err = normalizeMeta(meta)
+	if err != nil {
+		return err
+	}
+
+	client := w.withContext(ctx)
+	return mapError(w.writeWithMeta(ctx, client, path, meta, func(path string) error {
+		return client.WriteStream(path, stream, perm)
+	}))
+}
+
+// StreamToFileWithMeta - см. StreamToFileWithMetaCtx
+func (w *WebDav) StreamToFileWithMeta(stream io.Reader, path string, meta map[string]string) error {
+	return w.StreamToFileWithMetaCtx(context.Background(), stream, path, meta)
+}
+
+// writeWithMeta - записывает данные с помощью fn, а затем метаданные (мета-файл или свойства, см. WebDavPropMeta).
+// При атомарной записи и всегда, когда meta не nil, данные пишутся во временный файл и переименовываются (MOVE) в path
+// после записи метаданных, поэтому при ошибке потока или записи метаданных прежние данные и метаданные не изменяются.
+// Если не удался сам MOVE, прежний мета-файл восстанавливается. Если meta равно nil, прежние метаданные сохраняются
+func (w *WebDav) writeWithMeta(ctx context.Context, client *gowebdav.Client, path string, meta map[string]string, fn func(path string) error) error {
+	viaTemp := w.atomic || meta != nil
+	target := path
+	if viaTemp {
+		target = tempName(path)
+	}
+	if err := fn(target); err != nil {
+		if viaTemp {
+			client.Remove(target)
+		}
+		return err
+	}
+
+	sidecar := !w.props && meta != nil
+	var previous []byte
+	hadSidecar := false
+	if sidecar {
+		var err error
+		previous, err = client.Read(path + META_PREFIX)
+		hadSidecar = err == nil
+		if err != nil && !gowebdav.IsErrNotFound(err) {
+			client.Remove(target)
+			return err
+		}
+	}
+
+	if err := w.writeMeta(ctx, client, path, target, meta); err != nil {
+		if viaTemp {
+			client.Remove(target)
+		}
+		return err
+	}
+
+	if viaTemp {
+		if err := client.Rename(target, path, true); err != nil {
+			client.Remove(target)
+			if !sidecar {
+				return err
+			}
+			// новые метаданные не должны остаться рядом со старыми данными
+			if hadSidecar {
+				return errors.Join(err, w.write(client, path+META_PREFIX, func(path string) error {
+					return client.Write(path, previous, perm)
+				}))
+			}
+			return errors.Join(err, w.removeSidecar(client, path))
+		}
+	}
+	if w.props && meta != nil {
+		return w.removeSidecar(client, path)
 	}
-	return w.client.Read(path)
+	return nil
 }
 
-// GetFilePartially - возвращает часть содержимого файла
+// writeMeta - записывает метаданные файла path.
+// В режиме WebDavPropMeta метаданные записываются в свойства target - файла, в который записаны данные.
+// Если meta равно nil, в target переносятся свойства path, т.к. MOVE временного файла заменяет их
+func (w *WebDav) writeMeta(ctx context.Context, client *gowebdav.Client, path, target string, meta map[string]string) error {
+	if !w.props {
+		if meta == nil {
+			return nil
+		}
+		return w.write(client, path+META_PREFIX, func(path string) error {
+			return client.Write(path, meta2Bytes(meta), perm)
+		})
+	}
+
+	if meta == nil {
+		if target == path {
+			// при перезаписи ресурса сервер сохраняет его свойства
+			return nil
+		}
+		current, err := w.readProps(ctx, path)
+		if err != nil && !gowebdav.IsErrNotFound(err) {
+			return err
+		}
+		meta = current
+	}
+	return w.writeProps(ctx, target, meta)
+}
+
+// write - записывает файл с помощью fn.
+// Если включены атомарные записи, fn пишет во временный файл, который затем переименовывается (MOVE) в path
+func (w *WebDav) write(client *gowebdav.Client, path string, fn func(path string) error) error {
+	if !w.atomic {
+		return fn(path)
+	}
+
+	tmp := tempName(path)
+	if err := fn(tmp); err != nil {
+		client.Remove(tmp)
+		return err
+	}
+	if err := client.Rename(tmp, path, true); err != nil {
+		client.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// GetFileCtx - возвращает содержимое файла
+// ctx - контекст
 // path - путь к файлу
-// offset - смещение
-// length - длина
-func (w *WebDav) GetFilePartially(path string, offset, length int64) ([]byte, error) {
-	if !w.IsExist(path) {
-		return nil, nil
+func (w *WebDav) GetFileCtx(ctx context.Context, path string) ([]byte, error) {
+	path, err := w.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := w.withContext(ctx).Read(path)
+	if err != nil {
+		return nil, mapError(err)
 	}
+	return content, nil
+}
+
+// GetFile - см. GetFileCtx
+func (w *WebDav) GetFile(path string) ([]byte, error) {
+	return w.GetFileCtx(context.Background(), path)
+}
 
-	stream, err := w.client.ReadStreamRange(path, offset, length)
+// GetFilePartiallyCtx - возвращает часть содержимого файла
+// ctx - контекст
+// path - путь к файлу
+// offset - смещение
+// length - длина
+func (w *WebDav) GetFilePartiallyCtx(ctx context.Context, path string, offset, length int64) ([]byte, error) {
+	stream, err := w.FileReaderCtx(ctx, path, offset, length)
 	if err != nil {
 		return nil, err
 	}
@@ -78,82 +317,445 @@ func (w *WebDav) GetFilePartially(path string, offset, length int64) ([]byte, er
 	return buf.Bytes(), nil
 }
 
-// FileReader - возвращает io.ReadCloser для чтения файла
+// GetFilePartially - см. GetFilePartiallyCtx
+func (w *WebDav) GetFilePartially(path string, offset, length int64) ([]byte, error) {
+	return w.GetFilePartiallyCtx(context.Background(), path, offset, length)
+}
+
+// FileReaderCtx - возвращает io.ReadCloser для чтения файла
+// ctx - контекст, при отмене которого чтение прерывается
 // path - путь к файлу
 // offset - смещение
 // length - длина
+func (w *WebDav) FileReaderCtx(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	path, err := w.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := w.withContext(ctx).ReadStreamRange(path, offset, length)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return stream, nil
+}
+
+// FileReader - см. FileReaderCtx
 func (w *WebDav) FileReader(path string, offset, length int64) (io.ReadCloser, error) {
-	return w.client.ReadStreamRange(path, offset, length)
+	return w.FileReaderCtx(context.Background(), path, offset, length)
 }
 
-// RemoveFile - удаляет файл
+// RemoveFileCtx - удаляет файл
+// ctx - контекст
 // path - путь к файлу
+func (w *WebDav) RemoveFileCtx(ctx context.Context, path string) error {
+	path, err := w.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	client := w.withContext(ctx)
+	client.Remove(path + META_PREFIX)
+	return mapError(client.Remove(path))
+}
+
+// RemoveFile - см. RemoveFileCtx
 func (w *WebDav) RemoveFile(path string) error {
-	w.client.Remove(path + META_PREFIX)
-	return w.client.Remove(path)
+	return w.RemoveFileCtx(context.Background(), path)
 }
 
-// Stat - возвращает информацию о файле и метаданные
+// StatCtx - возвращает информацию о файле и метаданные
+// ctx - контекст
 // path - путь к файлу
-func (w *WebDav) Stat(path string) (os.FileInfo, map[string]string, error) {
-	info, err := w.client.Stat(path)
+func (w *WebDav) StatCtx(ctx context.Context, path string) (os.FileInfo, map[string]string, error) {
+	path, err := w.resolve(path)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	isExist := w.IsExist(path + META_PREFIX)
-	if !isExist {
-		return info, nil, nil
+	client := w.withContext(ctx)
+	info, err := client.Stat(path)
+	if err != nil {
+		return nil, nil, mapError(err)
 	}
 
-	meta, err := w.client.Read(path + META_PREFIX)
+	meta, err := w.readMeta(ctx, client, path)
 	if err != nil {
 		return nil, nil, err
 	}
+	return info, meta, nil
+}
 
-	return info, bytes2Meta(meta), nil
+// Stat - см. StatCtx
+func (w *WebDav) Stat(path string) (os.FileInfo, map[string]string, error) {
+	return w.StatCtx(context.Background(), path)
 }
 
-// ClearDir - очищает директорию
-// path - путь к директории
+// GetMetaCtx - возвращает метаданные файла
+// ctx - контекст
+// path - путь к файлу
+// Если файл не существует, возвращается ErrNotExist
+func (w *WebDav) GetMetaCtx(ctx context.Context, path string) (map[string]string, error) {
+	_, meta, err := w.StatCtx(ctx, path)
+	return meta, err
+}
+
+// GetMeta - см. GetMetaCtx
+func (w *WebDav) GetMeta(path string) (map[string]string, error) {
+	return w.GetMetaCtx(context.Background(), path)
+}
+
+// UpdateMetaCtx - изменяет метаданные файла без перезаписи его содержимого.
+// Перезаписывается только мета-файл, в режиме WebDavPropMeta - свойства файла (PROPPATCH)
+// ctx - контекст
+// path - путь к файлу
+// set - добавляемые и изменяемые ключи
+// unset - удаляемые ключи, удаляются до добавления set
+// Если файл не существует, возвращается ErrNotExist
+func (w *WebDav) UpdateMetaCtx(ctx context.Context, path string, set map[string]string, unset []string) error {
+	path, err := w.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	client := w.withContext(ctx)
+	info, err := client.Stat(path)
+	if err != nil {
+		return mapError(err)
+	}
+	if info.IsDir() {
+		return &os.PathError{Op: "updatemeta", Path: path, Err: syscall.EISDIR}
+	}
+
+	current, err := w.readMeta(ctx, client, path)
+	if err != nil {
+		return err
+	}
+	meta, err := mergeMeta(current, set, unset)
+	if err != nil {
+		return err
+	}
+
+	if w.props {
+		if err := w.writeProps(ctx, path, meta); err != nil {
+			return mapError(err)
+		}
+		return mapError(w.removeSidecar(client, path))
+	}
+	if len(meta) == 0 {
+		return mapError(w.removeSidecar(client, path))
+	}
+	return mapError(w.write(client, path+META_PREFIX, func(path string) error {
+		return client.Write(path, meta2Bytes(meta), perm)
+	}))
+}
+
+// UpdateMeta - см. UpdateMetaCtx
+func (w *WebDav) UpdateMeta(path string, set map[string]string, unset []string) error {
+	return w.UpdateMetaCtx(context.Background(), path, set, unset)
+}
+
+// readSidecar - читает мета-файл файла path, если мета-файла нет, возвращается nil
+func (w *WebDav) readSidecar(client *gowebdav.Client, path string) (map[string]string, error) {
+	meta, err := client.Read(path + META_PREFIX)
+	if gowebdav.IsErrNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return bytes2Meta(meta)
+}
+
+// ClearDirCtx - удаляет содержимое директории, сама директория сохраняется, как в Local.
+// Поддиректории удаляются рекурсивно на стороне сервера (DELETE коллекции),
+// одновременно выполняется не больше WebDavConcurrency запросов.
+// Ошибки отдельных элементов не прерывают удаление и возвращаются вместе через errors.Join
+// ctx - контекст
+// path - путь к директории, корень хранилища - "."
+// Если директория не существует или путь пустой, возвращается ErrNotExist
+func (w *WebDav) ClearDirCtx(ctx context.Context, path string) error {
+	if path == "" {
+		return emptyPathError("open")
+	}
+	path, err := w.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	client := w.withContext(ctx)
+	files, err := client.ReadDir(path)
+	if err != nil {
+		return mapError(err)
+	}
+	return w.removeEntries(ctx, client, path, files)
+}
+
+// ClearDir - см. ClearDirCtx
 func (w *WebDav) ClearDir(path string) error {
-	files, _ := w.client.ReadDir(path)
+	return w.ClearDirCtx(context.Background(), path)
+}
+
+// RemoveDirCtx - удаляет директорию вместе с содержимым, аналогично os.RemoveAll.
+// Сначала содержимое удаляется как в ClearDirCtx, затем сама директория,
+// поэтому при частичной ошибке удаленные элементы не восстанавливаются, а ошибки возвращаются вместе
+// ctx - контекст
+// path - путь к директории
+// Если директория не существует, возвращается ErrNotExist
+func (w *WebDav) RemoveDirCtx(ctx context.Context, path string) error {
+	if err := w.ClearDirCtx(ctx, path); err != nil {
+		return err
+	}
+
+	path, err := w.resolve(path)
+	if err != nil {
+		return err
+	}
+	return mapError(w.withContext(ctx).Remove(path))
+}
+
+// RemoveDir - см. RemoveDirCtx
+func (w *WebDav) RemoveDir(path string) error {
+	return w.RemoveDirCtx(context.Background(), path)
+}
+
+// removeEntries - удаляет элементы директории dir, включая мета-файлы и временные файлы,
+// не больше чем WebDavConcurrency запросами одновременно
+func (w *WebDav) removeEntries(ctx context.Context, client *gowebdav.Client, dir string, files []os.FileInfo) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	workers := make(chan struct{}, w.concurrency)
 	for _, file := range files {
-		if err := w.client.Remove(path + "/" + file.Name()); err != nil {
-			return err
+		if ctx.Err() != nil {
+			break
 		}
+		workers <- struct{}{}
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			if err := client.Remove(path); err != nil {
+				mu.Lock()
+				errs = append(errs, mapError(err))
+				mu.Unlock()
+			}
+		}(gowebdav.Join(dir, file.Name()))
 	}
-	return nil
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		// gowebdav не возвращает ошибку транспорта, поэтому отмена проверяется отдельно
+		return err
+	}
+	return errors.Join(errs...)
 }
 
-// MkdirAll - создает директорию
+// MkdirAllCtx - создает директорию
+// ctx - контекст
 // path - путь к директории
+func (w *WebDav) MkdirAllCtx(ctx context.Context, path string) error {
+	path, err := w.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	return mapError(w.withContext(ctx).MkdirAll(path, perm))
+}
+
+// MkdirAll - см. MkdirAllCtx
 func (w *WebDav) MkdirAll(path string) error {
-	return w.client.MkdirAll(path, perm)
+	return w.MkdirAllCtx(context.Background(), path)
+}
+
+// ReadDirCtx - возвращает содержимое директории без мета-файлов и временных файлов
+// ctx - контекст
+// path - путь к директории
+func (w *WebDav) ReadDirCtx(ctx context.Context, path string) ([]os.FileInfo, error) {
+	path, err := w.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := w.withContext(ctx).ReadDir(path)
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	names := make(map[string]bool, len(infos))
+	for _, info := range infos {
+		if !info.IsDir() {
+			names[info.Name()] = true
+		}
+	}
+
+	files := make([]os.FileInfo, 0, len(infos))
+	for _, info := range infos {
+		if !info.IsDir() && isServiceFile(info.Name(), func(name string) bool { return names[name] }) {
+			continue
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+// ReadDir - см. ReadDirCtx
+func (w *WebDav) ReadDir(path string) ([]os.FileInfo, error) {
+	return w.ReadDirCtx(context.Background(), path)
+}
+
+// WalkCtx - рекурсивно обходит директорию, пропуская мета-файлы и временные файлы
+// ctx - контекст, при отмене которого обход прерывается
+// path - путь к директории
+// fn - функция, вызываемая для каждого файла и директории
+func (w *WebDav) WalkCtx(ctx context.Context, path string, fn filepath.WalkFunc) error {
+	full, err := w.resolve(path)
+	if err != nil {
+		return fn(path, nil, err)
+	}
+	info, err := w.withContext(ctx).Stat(full)
+	if err != nil {
+		return fn(path, nil, mapError(err))
+	}
+	return walk(ctx, path, info, func(path string) ([]os.FileInfo, error) {
+		return w.ReadDirCtx(ctx, path)
+	}, fn)
+}
+
+// Walk - см. WalkCtx
+func (w *WebDav) Walk(path string, fn filepath.WalkFunc) error {
+	return w.WalkCtx(context.Background(), path, fn)
+}
+
+// CopyCtx - копирует файл вместе с метаданными на стороне сервера (COPY)
+// ctx - контекст
+// src - путь к исходному файлу
+// dst - путь к новому файлу
+func (w *WebDav) CopyCtx(ctx context.Context, src, dst string) error {
+	src, dst, err := w.resolvePair(src, dst)
+	if err != nil {
+		return err
+	}
+
+	client := w.withContext(ctx)
+	if err := client.Copy(src, dst, true); err != nil {
+		return mapError(err)
+	}
+	return w.syncMeta(client, src, dst, client.Copy)
+}
+
+// Copy - см. CopyCtx
+func (w *WebDav) Copy(src, dst string) error {
+	return w.CopyCtx(context.Background(), src, dst)
+}
+
+// MoveCtx - перемещает (переименовывает) файл вместе с метаданными на стороне сервера (MOVE)
+// ctx - контекст
+// src - путь к исходному файлу
+// dst - путь к новому файлу
+func (w *WebDav) MoveCtx(ctx context.Context, src, dst string) error {
+	src, dst, err := w.resolvePair(src, dst)
+	if err != nil {
+		return err
+	}
+
+	client := w.withContext(ctx)
+	if err := client.Rename(src, dst, true); err != nil {
+		return mapError(err)
+	}
+	return w.syncMeta(client, src, dst, client.Rename)
+}
+
+// Move - см. MoveCtx
+func (w *WebDav) Move(src, dst string) error {
+	return w.MoveCtx(context.Background(), src, dst)
+}
+
+// resolvePair - см. resolve
+func (w *WebDav) resolvePair(src, dst string) (string, string, error) {
+	src, err := w.resolve(src)
+	if err != nil {
+		return "", "", err
+	}
+	dst, err = w.resolve(dst)
+	if err != nil {
+		return "", "", err
+	}
+	return src, dst, nil
+}
+
+// syncMeta - переносит мета-файл src в dst с помощью fn.
+// Если у src нет мета-файла, устаревший мета-файл dst удаляется
+func (w *WebDav) syncMeta(client *gowebdav.Client, src, dst string, fn func(src, dst string, overwrite bool) error) error {
+	if _, err := client.Stat(src + META_PREFIX); err != nil {
+		if gowebdav.IsErrNotFound(err) {
+			return mapError(client.Remove(dst + META_PREFIX))
+		}
+		return mapError(err)
+	}
+	return mapError(fn(src+META_PREFIX, dst+META_PREFIX, true))
 }
 
-// CreateJsonFile - создает файл с данными в формате JSON
+// CreateJsonFileCtx - создает файл с данными в формате JSON
+// ctx - контекст
 // path - путь к файлу
 // data - данные
 // meta - метаданные
-func (w *WebDav) CreateJsonFile(path string, data interface{}, meta map[string]string) error {
+func (w *WebDav) CreateJsonFileCtx(ctx context.Context, path string, data interface{}, meta map[string]string) error {
 	content, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
 		return err
 	}
-	return w.CreateFile(path, content, meta)
+	return w.CreateFileCtx(ctx, path, content, meta)
+}
+
+// CreateJsonFile - см. CreateJsonFileCtx
+func (w *WebDav) CreateJsonFile(path string, data interface{}, meta map[string]string) error {
+	return w.CreateJsonFileCtx(context.Background(), path, data, meta)
 }
 
-// GetJsonFile - возвращает данные из файла в формате JSON
+// GetJsonFileCtx - возвращает данные из файла в формате JSON
+// ctx - контекст
 // path - путь к файлу
 // file - переменная для записи данных
-func (w *WebDav) GetJsonFile(path string, file interface{}) error {
-	content, err := w.GetFile(path)
+// Если файл не существует, возвращается ErrNotExist. Если файл пуст, file не изменяется и ошибка не возвращается
+func (w *WebDav) GetJsonFileCtx(ctx context.Context, path string, file interface{}) error {
+	content, err := w.GetFileCtx(ctx, path)
 	if err != nil {
 		return err
 	}
-	if content == nil {
+	if len(content) == 0 {
 		return nil
 	}
 	return json.Unmarshal(content, file)
 }
+
+// GetJsonFile - см. GetJsonFileCtx
+func (w *WebDav) GetJsonFile(path string, file interface{}) error {
+	return w.GetJsonFileCtx(context.Background(), path, file)
+}
+
+// PresignGet - возвращает ссылку для скачивания файла, подписанную PresignSecret, см. NewPresignHandler
+// path - путь к файлу
+// ttl - срок действия ссылки
+func (w *WebDav) PresignGet(path string, ttl time.Duration) (string, error) {
+	if _, err := w.resolve(path); err != nil {
+		return "", err
+	}
+	return presign(w.presign, http.MethodGet, path, ttl, nil)
+}
+
+// PresignPut - возвращает ссылку для загрузки файла, подписанную PresignSecret, см. NewPresignHandler.
+// Метаданные входят в подпись ссылки, поэтому дополнительные заголовки не нужны
+// path - путь к файлу
+// ttl - срок действия ссылки
+// meta - метаданные файла, при nil прежние метаданные сохраняются
+func (w *WebDav) PresignPut(path string, ttl time.Duration, meta map[string]string) (string, http.Header, error) {
+	if _, err := w.resolve(path); err != nil {
+		return "", nil, err
+	}
+	url, err := presign(w.presign, http.MethodPut, path, ttl, meta)
+	return url, nil, err
+}
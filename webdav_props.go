@@ -0,0 +1,256 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/studio-b12/gowebdav"
+)
+
+// propNamespace - пространство имен свойств WebDAV, в которых хранятся метаданные
+const propNamespace = "https://github.com/vlkalashnikov/go-store/meta"
+
+// propfindAll - тело запроса PROPFIND, возвращающего все свойства ресурса, в том числе мертвые
+const propfindAll = `<?xml version="1.0" encoding="utf-8"?><D:propfind xmlns:D="DAV:"><D:allprop/></D:propfind>`
+
+// multistatus - ответ 207 Multi-Status на PROPFIND и PROPPATCH
+type multistatus struct {
+	Responses []struct {
+		Propstats []struct {
+			Prop struct {
+				Props []struct {
+					XMLName xml.Name
+					Value   string `xml:",chardata"`
+				} `xml:",any"`
+			} `xml:"DAV: prop"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// statusCode - возвращает код из строки статуса "HTTP/1.1 200 OK"
+func statusCode(status string) int {
+	fields := strings.Fields(status)
+	if len(fields) < 2 {
+		return 0
+	}
+	code, _ := strconv.Atoi(fields[1])
+	return code
+}
+
+// propName - преобразует ключ метаданных в имя XML-элемента.
+// Символы ключа, недопустимые в имени элемента, и "_" кодируются как "_" и два шестнадцатеричных символа
+func propName(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		valid := c >= 'a' && c <= 'z' || i > 0 && (c >= '0' && c <= '9' || c == '-' || c == '.')
+		if valid {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('_')
+		b.WriteString(strconv.FormatUint(uint64(c)|0x100, 16)[1:])
+	}
+	return b.String()
+}
+
+// propKey - преобразует имя XML-элемента в ключ метаданных, см. propName
+func propKey(name string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '_' {
+			b.WriteByte(name[i])
+			continue
+		}
+		if i+2 >= len(name) {
+			return "", false
+		}
+		c, err := strconv.ParseUint(name[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", false
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String(), true
+}
+
+// propRequest - выполняет запрос WebDAV с XML-телом, которого нет в gowebdav.Client (PROPPATCH, PROPFIND allprop).
+// Авторизация выполняется так же, как в gowebdav.Client, с общим Authorizer, запрос - через WebDavHTTPClient
+// ctx - контекст
+// method - метод запроса
+// path - путь к ресурсу на сервере
+// body - тело запроса
+func (w *WebDav) propRequest(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	uri := gowebdav.PathEscape(gowebdav.Join(gowebdav.FixSlash(w.host), path))
+	auth, _ := w.auth.NewAuthenticator(bytes.NewReader(body))
+	defer auth.Close()
+
+	client := w.http
+	for {
+		r, err := http.NewRequestWithContext(ctx, method, uri, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Content-Type", "application/xml;charset=UTF-8")
+		r.Header.Set("Accept", "application/xml,text/xml")
+		if method == "PROPFIND" {
+			r.Header.Set("Depth", "0")
+		}
+		if err := auth.Authorize(client, r, path); err != nil {
+			return nil, err
+		}
+
+		rs, err := client.Do(r)
+		if err != nil {
+			return nil, err
+		}
+		redo, err := auth.Verify(client, rs, path)
+		if err != nil {
+			rs.Body.Close()
+			return nil, err
+		}
+		if !redo {
+			return rs, nil
+		}
+		rs.Body.Close()
+	}
+}
+
+// multistatusRequest - выполняет запрос propRequest и разбирает ответ 207 Multi-Status.
+// Другие коды ответа возвращаются как ошибка gowebdav, которую можно передать в mapError
+func (w *WebDav) multistatusRequest(ctx context.Context, method, path string, body []byte) (*multistatus, error) {
+	rs, err := w.propRequest(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusMultiStatus {
+		return nil, gowebdav.NewPathError(method, path, rs.StatusCode)
+	}
+	ms := new(multistatus)
+	if err := xml.NewDecoder(rs.Body).Decode(ms); err != nil {
+		return nil, gowebdav.NewPathErrorErr(method, path, err)
+	}
+	return ms, nil
+}
+
+// readProps - читает метаданные из мертвых свойств ресурса path в пространстве имен propNamespace.
+// Если свойств нет, возвращается nil
+func (w *WebDav) readProps(ctx context.Context, path string) (map[string]string, error) {
+	ms, err := w.multistatusRequest(ctx, "PROPFIND", path, []byte(propfindAll))
+	if err != nil {
+		return nil, err
+	}
+
+	var meta map[string]string
+	for _, response := range ms.Responses {
+		for _, propstat := range response.Propstats {
+			if statusCode(propstat.Status) != http.StatusOK {
+				continue
+			}
+			for _, prop := range propstat.Prop.Props {
+				if prop.XMLName.Space != propNamespace {
+					continue
+				}
+				key, ok := propKey(prop.XMLName.Local)
+				if !ok {
+					continue
+				}
+				if meta == nil {
+					meta = make(map[string]string)
+				}
+				meta[key] = prop.Value
+			}
+		}
+	}
+	return meta, nil
+}
+
+// writeProps - заменяет метаданные в мертвых свойствах ресурса path на meta одним запросом PROPPATCH.
+// Свойства, которых нет в meta, удаляются
+func (w *WebDav) writeProps(ctx context.Context, path string, meta map[string]string) error {
+	current, err := w.readProps(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(meta))
+	for key := range meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var removed []string
+	for key := range current {
+		if _, ok := meta[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	if len(keys) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	body := new(bytes.Buffer)
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?><D:propertyupdate xmlns:D="DAV:" xmlns:S="` + propNamespace + `">`)
+	if len(keys) > 0 {
+		body.WriteString("<D:set><D:prop>")
+		for _, key := range keys {
+			name := propName(key)
+			body.WriteString("<S:" + name + ">")
+			xml.EscapeText(body, []byte(meta[key]))
+			body.WriteString("</S:" + name + ">")
+		}
+		body.WriteString("</D:prop></D:set>")
+	}
+	if len(removed) > 0 {
+		body.WriteString("<D:remove><D:prop>")
+		for _, key := range removed {
+			body.WriteString("<S:" + propName(key) + "/>")
+		}
+		body.WriteString("</D:prop></D:remove>")
+	}
+	body.WriteString("</D:propertyupdate>")
+
+	ms, err := w.multistatusRequest(ctx, "PROPPATCH", path, body.Bytes())
+	if err != nil {
+		return err
+	}
+	for _, response := range ms.Responses {
+		for _, propstat := range response.Propstats {
+			if code := statusCode(propstat.Status); code < 200 || code > 299 {
+				return gowebdav.NewPathError("PROPPATCH", path, code)
+			}
+		}
+	}
+	return nil
+}
+
+// readMeta - читает метаданные файла path: при WebDavPropMeta сначала из свойств, затем из мета-файла
+func (w *WebDav) readMeta(ctx context.Context, client *gowebdav.Client, path string) (map[string]string, error) {
+	if w.props {
+		meta, err := w.readProps(ctx, path)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		if len(meta) > 0 {
+			return meta, nil
+		}
+	}
+	return w.readSidecar(client, path)
+}
+
+// removeSidecar - удаляет мета-файл файла path, если он есть
+func (w *WebDav) removeSidecar(client *gowebdav.Client, path string) error {
+	if err := client.Remove(path + META_PREFIX); err != nil && !gowebdav.IsErrNotFound(err) {
+		return err
+	}
+	return nil
+}
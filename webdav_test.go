@@ -0,0 +1,294 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+
+	"github.com/studio-b12/gowebdav"
+	"github.com/vlkalashnikov/go-store"
+	"github.com/vlkalashnikov/go-store/storetest"
+	"golang.org/x/net/webdav"
+)
+
+func TestWebDav(t *testing.T) {
+	storetest.RunConformance(t, func(t *testing.T) store.StoreIFace {
+		return newWebDav(t, store.WebDavConfig{})
+	})
+}
+
+func TestWebDavRoot(t *testing.T) {
+	storetest.RunConformance(t, func(t *testing.T) store.StoreIFace {
+		return newWebDav(t, store.WebDavConfig{WebDavRoot: "/tenant/a"})
+	})
+}
+
+func TestWebDavRootEscape(t *testing.T) {
+	s := newWebDav(t, store.WebDavConfig{WebDavRoot: "/tenant/a"})
+
+	for _, p := range []string{"../b/file.txt", "dir/../../b/file.txt", "/file.txt"} {
+		if err := s.CreateFile(p, []byte("data"), nil); !errors.Is(err, store.ErrOutsideRoot) {
+			t.Errorf("CreateFile(%q) error = %v, want ErrOutsideRoot", p, err)
+		}
+	}
+}
+
+func TestWebDavAtomicWrites(t *testing.T) {
+	storetest.RunConformance(t, func(t *testing.T) store.StoreIFace {
+		return newWebDav(t, store.WebDavConfig{WebDavAtomicWrites: true})
+	})
+}
+
+// TestWebDavAtomicStream - проверяет, что при атомарной записи прерванный поток не изменяет файл
+func TestWebDavAtomicStream(t *testing.T) {
+	s := newWebDav(t, store.WebDavConfig{WebDavAtomicWrites: true})
+	if err := s.CreateFile("file.txt", []byte("old"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := io.MultiReader(strings.NewReader("new content"), iotest.ErrReader(errors.New("broken stream")))
+	if err := s.StreamToFile(stream, "file.txt"); err == nil {
+		t.Fatal("StreamToFile with broken stream succeeded")
+	}
+
+	content, err := s.GetFile("file.txt")
+	if err != nil || string(content) != "old" {
+		t.Fatalf("GetFile = %q, %v; want old content", content, err)
+	}
+	infos, err := s.ReadDir("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("ReadDir returned %d entries, want 1", len(infos))
+	}
+}
+
+func TestWebDavPropMeta(t *testing.T) {
+	storetest.RunConformance(t, func(t *testing.T) store.StoreIFace {
+		return newWebDav(t, store.WebDavConfig{WebDavPropMeta: true})
+	})
+}
+
+func TestWebDavPropMetaAtomicWrites(t *testing.T) {
+	storetest.RunConformance(t, func(t *testing.T) store.StoreIFace {
+		return newWebDav(t, store.WebDavConfig{WebDavPropMeta: true, WebDavAtomicWrites: true})
+	})
+}
+
+// TestWebDavPropMetaNoSidecar - проверяет, что метаданные хранятся в свойствах, а мета-файлы не создаются,
+// и что мета-файлы, записанные до включения WebDavPropMeta, читаются и заменяются свойствами
+func TestWebDavPropMetaNoSidecar(t *testing.T) {
+	host := newWebDavServer(t)
+	props, err := store.NewWebDav(store.WebDavConfig{WebDavHost: host, WebDavPropMeta: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sidecars, err := store.NewWebDav(store.WebDavConfig{WebDavHost: host})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := gowebdav.NewClient(host, "", "")
+
+	if err := props.CreateFile("file.txt", []byte("data"), map[string]string{"author": "store"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Stat("file.txt.meta"); !gowebdav.IsErrNotFound(err) {
+		t.Fatalf("Stat(file.txt.meta) error = %v, want not found", err)
+	}
+	if meta, err := props.GetMeta("file.txt"); err != nil || meta["author"] != "store" {
+		t.Fatalf("GetMeta = %v, %v; want author=store", meta, err)
+	}
+
+	if err := sidecars.CreateFile("legacy.txt", []byte("data"), map[string]string{"author": "legacy"}); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err := props.GetMeta("legacy.txt"); err != nil || meta["author"] != "legacy" {
+		t.Fatalf("GetMeta(legacy.txt) = %v, %v; want author=legacy", meta, err)
+	}
+	if err := props.UpdateMeta("legacy.txt", map[string]string{"version": "2"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Stat("legacy.txt.meta"); !gowebdav.IsErrNotFound(err) {
+		t.Fatalf("Stat(legacy.txt.meta) error = %v, want not found", err)
+	}
+	meta, err := props.GetMeta("legacy.txt")
+	if err != nil || meta["author"] != "legacy" || meta["version"] != "2" {
+		t.Fatalf("GetMeta(legacy.txt) = %v, %v; want author=legacy, version=2", meta, err)
+	}
+}
+
+// TestWebDavClearDir - проверяет, что ClearDir возвращает ошибки сервера, удаляет вложенные директории
+// и продолжает удаление после ошибки отдельного элемента
+func TestWebDavClearDir(t *testing.T) {
+	handler := &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" && strings.HasSuffix(r.URL.Path, "/locked.txt") {
+			http.Error(w, "locked", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	s, err := store.NewWebDav(store.WebDavConfig{WebDavHost: srv.URL, WebDavConcurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dav := s.(*store.WebDav)
+
+	if err := s.ClearDir("missing"); !errors.Is(err, store.ErrNotExist) {
+		t.Fatalf("ClearDir(missing) error = %v, want ErrNotExist", err)
+	}
+
+	if err := s.MkdirAll("dir/sub/deep"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"dir/a.txt", "dir/b.txt", "dir/locked.txt", "dir/sub/deep/c.txt"} {
+		if err := s.CreateFile(p, []byte("data"), map[string]string{"author": "store"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = s.ClearDir("dir")
+	if !errors.Is(err, store.ErrPermission) {
+		t.Fatalf("ClearDir error = %v, want ErrPermission", err)
+	}
+	infos, err := gowebdav.NewClient(srv.URL, "", "").ReadDir("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, info := range infos {
+		left = append(left, info.Name())
+	}
+	if len(left) != 1 || left[0] != "locked.txt" {
+		t.Fatalf("ClearDir left %v, want only locked.txt", left)
+	}
+
+	if err := s.MkdirAll("other/sub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateFile("other/sub/file.txt", []byte("data"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := dav.RemoveDir("other"); err != nil {
+		t.Fatalf("RemoveDir: %v", err)
+	}
+	if s.IsExist("other") {
+		t.Fatal("RemoveDir kept the directory")
+	}
+}
+
+// TestWebDavMetaFailure - проверяет, что без атомарной записи ошибка записи метаданных или MOVE
+// не оставляет новые данные со старыми метаданными и наоборот
+func TestWebDavMetaFailure(t *testing.T) {
+	var denyMeta, denyMove atomic.Bool
+	handler := &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (denyMeta.Load() && r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, store.META_PREFIX)) ||
+			(denyMove.Load() && r.Method == "MOVE" && strings.HasSuffix(r.Header.Get("Destination"), "/file.txt")) {
+			http.Error(w, "denied", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	s, err := store.NewWebDav(store.WebDavConfig{WebDavHost: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateFile("file.txt", []byte("old"), map[string]string{"version": "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, deny := range []*atomic.Bool{&denyMeta, &denyMove} {
+		deny.Store(true)
+		if err := s.StreamToFileWithMeta(strings.NewReader("new"), "file.txt", map[string]string{"version": "2"}); err == nil {
+			t.Fatal("StreamToFileWithMeta succeeded")
+		}
+		deny.Store(false)
+
+		content, err := s.GetFile("file.txt")
+		if err != nil || string(content) != "old" {
+			t.Fatalf("GetFile = %q, %v; want old content", content, err)
+		}
+		if meta, err := s.GetMeta("file.txt"); err != nil || meta["version"] != "1" {
+			t.Fatalf("GetMeta = %v, %v; want old meta", meta, err)
+		}
+	}
+}
+
+// countingTransport - http.RoundTripper, который считает выполненные через него запросы
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// TestWebDavHTTPClient - все запросы, в том числе с контекстом и PROPPATCH/PROPFIND, выполняются через WebDavHTTPClient
+func TestWebDavHTTPClient(t *testing.T) {
+	var served atomic.Int32
+	handler := &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	transport := new(countingTransport)
+	s, err := store.NewWebDav(store.WebDavConfig{
+		WebDavHost:       srv.URL,
+		WebDavPropMeta:   true,
+		WebDavHTTPClient: &http.Client{Transport: transport},
+	})
+	if err != nil {
+		t.Fatalf("NewWebDav: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.(store.StoreCtxIFace).CreateFileCtx(ctx, "file.txt", []byte("data"), map[string]string{"author": "store"}); err != nil {
+		t.Fatalf("CreateFileCtx: %v", err)
+	}
+	if err := s.UpdateMeta("file.txt", map[string]string{"version": "2"}, nil); err != nil {
+		t.Fatalf("UpdateMeta: %v", err)
+	}
+	if meta, err := s.GetMeta("file.txt"); err != nil || meta["author"] != "store" {
+		t.Fatalf("GetMeta = %v, %v", meta, err)
+	}
+
+	if n := transport.requests.Load(); n == 0 || n != served.Load() {
+		t.Fatalf("requests through WebDavHTTPClient = %d, served = %d", n, served.Load())
+	}
+}
+
+// newWebDav - запускает WebDAV-сервер в памяти и возвращает подключенное к нему хранилище
+func newWebDav(t *testing.T, cfg store.WebDavConfig) store.StoreIFace {
+	t.Helper()
+	cfg.WebDavHost = newWebDavServer(t)
+	s, err := store.NewWebDav(cfg)
+	if err != nil {
+		t.Fatalf("NewWebDav: %v", err)
+	}
+	return s
+}
+
+// newWebDavServer - запускает WebDAV-сервер в памяти и возвращает его адрес
+func newWebDavServer(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(&webdav.Handler{
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	})
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
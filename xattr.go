@@ -0,0 +1,15 @@
+package store
+
+import "errors"
+
+// xattrPrefix - пространство имен расширенных атрибутов, в которых хранятся метаданные.
+// Атрибуты других программ (например, user.xdg.origin.url) не читаются и не удаляются
+const xattrPrefix = "user.go-store."
+
+// errXattrNotSupported - файловая система или платформа не поддерживает расширенные атрибуты
+var errXattrNotSupported = errors.New("extended attributes are not supported")
+
+// xattrNotSupported - проверяет, что ошибка вызвана отсутствием поддержки расширенных атрибутов
+func xattrNotSupported(err error) bool {
+	return errors.Is(err, errXattrNotSupported)
+}
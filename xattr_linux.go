@@ -0,0 +1,117 @@
+//go:build linux
+
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// getXattrs - возвращает метаданные из расширенных атрибутов xattrPrefix* файла path.
+// Если атрибутов нет, возвращается nil
+func getXattrs(path string) (map[string]string, error) {
+	names, err := listXattrs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta map[string]string
+	for _, name := range names {
+		value, err := getXattr(path, name)
+		if errors.Is(err, syscall.ENODATA) {
+			// атрибут удален после получения списка
+			continue
+		}
+		if err != nil {
+			return nil, xattrError(err)
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta[strings.TrimPrefix(name, xattrPrefix)] = string(value)
+	}
+	return meta, nil
+}
+
+// setXattrs - заменяет метаданные в расширенных атрибутах xattrPrefix* файла path:
+// ключи meta записываются, остальные атрибуты xattrPrefix* удаляются, атрибуты других программ не изменяются
+func setXattrs(path string, meta map[string]string) error {
+	names, err := listXattrs(path)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range meta {
+		if err := syscall.Setxattr(path, xattrPrefix+key, []byte(value), 0); err != nil {
+			return xattrError(err)
+		}
+	}
+	for _, name := range names {
+		if _, ok := meta[strings.TrimPrefix(name, xattrPrefix)]; ok {
+			continue
+		}
+		if err := syscall.Removexattr(path, name); err != nil && !errors.Is(err, syscall.ENODATA) {
+			return xattrError(err)
+		}
+	}
+	return nil
+}
+
+// listXattrs - возвращает имена расширенных атрибутов xattrPrefix* файла path
+func listXattrs(path string) ([]string, error) {
+	buf, err := readXattr(func(dest []byte) (int, error) {
+		return syscall.Listxattr(path, dest)
+	})
+	if err != nil {
+		return nil, xattrError(err)
+	}
+
+	var names []string
+	for _, name := range bytes.Split(buf, []byte{0}) {
+		if bytes.HasPrefix(name, []byte(xattrPrefix)) {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	return readXattr(func(dest []byte) (int, error) {
+		return syscall.Getxattr(path, name, dest)
+	})
+}
+
+// readXattr - вызывает fn сначала для определения размера, затем для чтения.
+// Если атрибут изменился между вызовами (ERANGE), чтение повторяется
+func readXattr(fn func(dest []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := fn(nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, size)
+		n, err := fn(buf)
+		if errors.Is(err, syscall.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
+
+// xattrError - сопоставляет ENOTSUP с errXattrNotSupported
+func xattrError(err error) error {
+	if errors.Is(err, syscall.ENOTSUP) {
+		return fmt.Errorf("%w: %v", errXattrNotSupported, err)
+	}
+	return err
+}
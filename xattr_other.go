@@ -0,0 +1,11 @@
+//go:build !linux
+
+package store
+
+func getXattrs(path string) (map[string]string, error) {
+	return nil, errXattrNotSupported
+}
+
+func setXattrs(path string, meta map[string]string) error {
+	return errXattrNotSupported
+}